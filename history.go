@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Bonial-International-GmbH/sops-check/internal/cli"
+	"github.com/Bonial-International-GmbH/sops-check/internal/config"
+	"github.com/Bonial-International-GmbH/sops-check/internal/git"
+	"github.com/Bonial-International-GmbH/sops-check/internal/report"
+	"github.com/Bonial-International-GmbH/sops-check/internal/rules"
+	"github.com/Bonial-International-GmbH/sops-check/internal/sops"
+)
+
+// checkHistory evaluates the rules for every version of every SOPS file below
+// the check paths in the commits of their git repositories. Each distinct blob
+// is only checked once per path, and reported with the first commit that
+// introduced it. This reveals files which remain decryptable from the
+// history, e.g. with a revoked key, even if their current version is
+// compliant.
+func checkHistory(w io.Writer, rootRule rules.Rule, cfg *config.Config, formats *sops.FormatResolver, args *cli.Args) ([]string, error) {
+	h := &historyCheck{
+		text:     textOutput(w, args),
+		rootRule: rootRule,
+		cfg:      cfg,
+		formats:  formats,
+		args:     args,
+		scope:    rules.NewScope(cfg.Paths, cfg.ExcludePaths),
+		now:      evalTime(args),
+		seen:     make(map[historyBlob]bool),
+	}
+
+	for _, checkPath := range args.CheckPaths {
+		if err := h.checkPath(checkPath); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeReports(w, rootRule, &h.rep, args); err != nil {
+		return nil, err
+	}
+
+	if len(h.problematicFiles) > 0 {
+		return nil, fmt.Errorf("found %d file versions with issues in the history:%s", len(h.problematicFiles), formatFileList(h.problematicFiles))
+	}
+
+	return h.warningFiles, nil
+}
+
+// historyBlob identifies a version of a file in the history. The same blob
+// may be found at different paths, which can be subject to different rules.
+type historyBlob struct {
+	id   string
+	path string
+}
+
+// historyCheck holds the state of checking the history of all check paths.
+type historyCheck struct {
+	text     io.Writer
+	rootRule rules.Rule
+	cfg      *config.Config
+	formats  *sops.FormatResolver
+	args     *cli.Args
+	scope    *rules.Scope
+	now      time.Time
+	seen     map[historyBlob]bool
+
+	rep              report.Report
+	problematicFiles []string
+	warningFiles     []string
+}
+
+// checkPath checks the history of all files below checkPath, which may be a
+// subdirectory of a git repository.
+func (h *historyCheck) checkPath(checkPath string) error {
+	// Blob paths are relative to the top-level directory of the repository,
+	// which differs from checkPath if it is a subdirectory.
+	topLevel, err := git.TopLevel(checkPath)
+	if err != nil {
+		return fmt.Errorf("failed to find git repository of %s: %w", checkPath, err)
+	}
+
+	resolvedCheckPath, err := filepath.EvalSymlinks(checkPath)
+	if err != nil {
+		return err
+	}
+
+	resolvedCheckPath, err = filepath.Abs(resolvedCheckPath)
+	if err != nil {
+		return err
+	}
+
+	matcher, err := newIgnoreMatcher(h.cfg, h.args, checkPath)
+	if err != nil {
+		return err
+	}
+
+	commits, err := git.Commits(checkPath, h.args.History.Range, h.args.History.Since, h.args.History.Until)
+	if err != nil {
+		return fmt.Errorf("failed to list commits: %w", err)
+	}
+
+	reader, err := git.NewBlobReader(checkPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for _, commit := range commits {
+		blobs, err := git.ChangedBlobs(checkPath, commit)
+		if err != nil {
+			return fmt.Errorf("failed to list files of commit %s: %w", commit, err)
+		}
+
+		for _, blob := range blobs {
+			absPath := filepath.Join(topLevel, filepath.FromSlash(blob.Path))
+
+			relPath, err := filepath.Rel(resolvedCheckPath, absPath)
+			if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+				continue
+			}
+
+			key := historyBlob{id: blob.ID, path: absPath}
+			if h.seen[key] || !h.scope.Matches(blob.Path) {
+				continue
+			}
+
+			// Ignore patterns are relative to checkPath, like when
+			// walking it.
+			ignored, err := matcher.Match(filepath.Join(checkPath, relPath), false)
+			if err != nil {
+				return err
+			}
+
+			if ignored {
+				continue
+			}
+
+			h.seen[key] = true
+
+			data, err := reader.Read(blob.ID)
+			if err != nil {
+				return err
+			}
+
+			h.checkBlob(blob, commit, data)
+		}
+	}
+
+	return nil
+}
+
+// checkBlob checks a single version of a file introduced by commit.
+func (h *historyCheck) checkBlob(blob git.Blob, commit string, data []byte) {
+	name := fmt.Sprintf("%s (commit %s)", blob.Path, commit)
+
+	file, err := sops.ParseFile(blob.Path, data, h.formats)
+	if err != nil {
+		h.addMalformed(blob, commit, name, err)
+		return
+	}
+
+	if file == nil {
+		return
+	}
+
+	result := evalFile(h.rootRule, file, h.now)
+
+	writeResult(h.text, name, result)
+
+	entry := report.File{
+		Path:   blob.Path,
+		Commit: commit,
+		Status: report.StatusPass,
+		Result: &result,
+	}
+
+	switch {
+	case isProblematic(result, h.cfg):
+		h.problematicFiles = append(h.problematicFiles, name)
+		entry.Status = report.StatusFail
+	case result.Severity() != "":
+		h.warningFiles = append(h.warningFiles, name)
+		entry.Status = report.StatusWarning
+	}
+
+	// Regions are omitted, because they would point into a historical
+	// version of the file instead of the checked out one.
+	for _, sarifResult := range result.SarifResults(blob.Path, nil, h.cfg.AllowUnmatched) {
+		entry.SarifResults = append(entry.SarifResults, historySarifResult(sarifResult, commit))
+	}
+
+	h.rep.Add(entry)
+}
+
+// addMalformed reports a version of a file whose SOPS metadata could not be
+// loaded, like checkFiles does for malformed files.
+func (h *historyCheck) addMalformed(blob git.Blob, commit, name string, err error) {
+	issue := checkMalformedFile(h.text, &sops.MalformedFile{Path: name, Err: err}, h.args.FailOnMalformed)
+	issue.File = blob.Path
+
+	entry := issueFile(report.StatusWarning, historySarifResult(issue, commit))
+	entry.Commit = commit
+
+	// Malformed files can only fail the check if explicitly requested.
+	if h.args.FailOnMalformed {
+		h.problematicFiles = append(h.problematicFiles, name)
+		entry.Status = report.StatusFail
+	} else {
+		h.warningFiles = append(h.warningFiles, name)
+	}
+
+	h.rep.Add(entry)
+}
+
+// historySarifResult prefixes the message of result with the commit it was
+// found in.
+func historySarifResult(result rules.SarifResult, commit string) rules.SarifResult {
+	result.Message = fmt.Sprintf("Commit %s:\n%s", commit, result.Message)
+	return result
+}
@@ -1,31 +1,151 @@
 package cli
 
-import "github.com/alecthomas/kingpin/v2"
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+)
 
 // Version is the current version of the app, generated at build time.
 var Version = "unknown"
 
 // Args are configuration options parsed from CLI args.
 type Args struct {
-	// CheckPath is the filesystem path to search for SOPS files.
-	CheckPath string
+	// CheckPaths are the filesystem paths to search for SOPS files. Paths
+	// may be directories or files, and StdinPath reads a single file from
+	// stdin.
+	CheckPaths []string
+	// StdinFormat is the format of the file read from stdin. If empty, it is
+	// determined from StdinFilename.
+	StdinFormat string
+	// StdinFilename is the path reported for the file read from stdin, which
+	// is also used for path-scoped rules.
+	StdinFilename string
 	// ConfigPath is the path of the sops-check configuration file.
 	ConfigPath string
 	// SarifReportPath is the path where the SARIF report should be saved.
 	SarifReportPath string
+	// Output is the format of the output written to stdout, one of
+	// OutputFormats. If not provided explicitly, it is detected from the CI
+	// environment.
+	Output string
+	// Reports are the reports to write to files in addition to the output.
+	Reports []Report
 	// IgnoreFilePath is the path of the ignorefile.
 	IgnoreFilePath []string
+	// NoDefaultIgnores disables honoring .gitignore files and the
+	// .sops-checkignore file in the check path.
+	NoDefaultIgnores bool
+	// ExplainIgnore is a path for which to explain whether and why it is
+	// ignored, instead of running the checks.
+	ExplainIgnore string
+	// CheckCreationRules enables reporting files whose key groups differ from
+	// the matching creation rule in the nearest .sops.yaml file.
+	CheckCreationRules bool
+	// NoLintCreationRules disables evaluating the rules against the creation
+	// rules of .sops.yaml files.
+	NoLintCreationRules bool
+	// FailOnMalformed makes files which look like SOPS files, but cannot be
+	// loaded, fail the check instead of only reporting them as warnings.
+	FailOnMalformed bool
+	// FormatOverrides force the format of files matching gitignore-style
+	// patterns, in the form `<pattern>=<format>`.
+	FormatOverrides []string
+	// ChangedSince restricts the check to files added or modified between
+	// this git ref and the working tree.
+	ChangedSince string
+	// MaxDepth limits how many levels of directories below each check path
+	// are searched, where 1 only includes files directly in the path. If not
+	// positive, there is no limit.
+	MaxDepth int
+	// FollowSymlinks enables searching symlinked directories.
+	FollowSymlinks bool
+	// Jobs is the number of files to process concurrently. If not positive,
+	// GOMAXPROCS is used.
+	Jobs int
+	// Now overrides the current time used to evaluate age-based rules. If
+	// zero, the current time is used.
+	Now time.Time
+	// History is set if the history subcommand was invoked. CheckPaths
+	// contains directories within git repositories in that case.
+	History *HistoryArgs
+}
+
+// HistoryArgs are options of the history subcommand.
+type HistoryArgs struct {
+	// Range is the git revision range whose commits are scanned.
+	Range string
+	// Since and Until optionally bound the dates of scanned commits.
+	Since string
+	Until string
 }
 
+// Report is a report written to a file.
+type Report struct {
+	// Format is the format of the report, e.g. ReportJSON.
+	Format string
+	// Path is the path of the report file.
+	Path string
+}
+
+// StdinPath is the check path which reads a file from stdin.
+const StdinPath = "-"
+
+// Output formats.
+const (
+	// OutputText is the human readable output.
+	OutputText = "text"
+	// OutputJSON is the JSON report, which replaces the human readable
+	// output.
+	OutputJSON = "json"
+	// OutputGitHub are GitHub Actions workflow commands annotating the
+	// affected files, which follow the human readable output.
+	OutputGitHub = "github"
+	// OutputGitLabCodeQuality is the GitLab Code Quality report, which
+	// replaces the human readable output.
+	OutputGitLabCodeQuality = "gitlab-codequality"
+)
+
+// OutputFormats contains all supported output formats.
+var OutputFormats = []string{OutputText, OutputJSON, OutputGitHub, OutputGitLabCodeQuality}
+
+// Report formats.
+const (
+	// ReportJSON is the JSON report containing the full evaluation results.
+	ReportJSON = "json"
+	// ReportSARIF is the SARIF report.
+	ReportSARIF = "sarif"
+	// ReportJUnit is the JUnit XML report, in which every file is a test
+	// case.
+	ReportJUnit = "junit"
+	// ReportGitLabCodeQuality is the GitLab Code Quality report.
+	ReportGitLabCodeQuality = "gitlab-codequality"
+)
+
+// ReportFormats contains all supported report formats.
+var ReportFormats = []string{ReportJSON, ReportSARIF, ReportJUnit, ReportGitLabCodeQuality}
+
+// GitLabCodeQualityReportPath is the path of the GitLab Code Quality report
+// written by default in GitLab CI.
+const GitLabCodeQualityReportPath = "gl-code-quality-report.json"
+
 // Defaults apply to arguments not provided explicitly.
 var Defaults = &Args{
-	CheckPath:  ".",
-	ConfigPath: ".sops-check.yaml",
+	CheckPaths:    []string{"."},
+	ConfigPath:    ".sops-check.yaml",
+	StdinFilename: "<stdin>",
+	Output:        OutputText,
 }
 
 // ParseArgs parses arguments from the command line.
 func ParseArgs(commandLine []string) (*Args, error) {
 	args := &Args{}
+	var now string
+	var reports []string
 
 	app := kingpin.New(
 		"sops-check",
@@ -44,18 +164,162 @@ func ParseArgs(commandLine []string) (*Args, error) {
 	app.Flag("sarif-report-path", "Path where the SARIF report should be created.").
 		StringVar(&args.SarifReportPath)
 
-	app.Flag("ignore-file", "Path to the ignorefile.").
+	app.Flag("output", fmt.Sprintf("Format of the output, one of %s. The json and gitlab-codequality reports replace the human readable output. Defaults to github in GitHub Actions and to text otherwise. In GitLab CI, a gitlab-codequality report is additionally written to %s unless the output or such a report is requested explicitly.", strings.Join(OutputFormats, ", "), GitLabCodeQualityReportPath)).
+		Short('o').
+		EnumVar(&args.Output, OutputFormats...)
+
+	app.Flag("report", fmt.Sprintf("Write a report to a file, in the form <format>=<path>, where format is one of %s. Can be repeated.", strings.Join(ReportFormats, ", "))).
+		StringsVar(&reports)
+
+	app.Flag("ignore-file", "Path to an additional ignorefile, whose patterns are relative to the checked directory. Can be repeated.").
 		Short('i').
 		StringsVar(&args.IgnoreFilePath)
 
-	// Positional arguments.
-	app.Arg("path", "Directory to run the checks in. If omitted, checks are run in the current working directory.").
-		Default(Defaults.CheckPath).
-		StringVar(&args.CheckPath)
+	app.Flag("no-default-ignores", "Do not honor .gitignore files and the .sops-checkignore file in the checked directory, and do not skip .git directories.").
+		BoolVar(&args.NoDefaultIgnores)
+
+	app.Flag("explain-ignore", "Explain whether and why the given path is ignored, instead of running the checks.").
+		StringVar(&args.ExplainIgnore)
+
+	app.Flag("check-creation-rules", "Report files whose key groups differ from the matching creation rule in the nearest .sops.yaml file.").
+		BoolVar(&args.CheckCreationRules)
+
+	app.Flag("no-lint-creation-rules", "Do not check the trust anchors of the creation rules in .sops.yaml files against the rules.").
+		BoolVar(&args.NoLintCreationRules)
+
+	app.Flag("fail-on-malformed", "Fail the check if malformed or unreadable SOPS files are found, instead of only reporting them as warnings.").
+		BoolVar(&args.FailOnMalformed)
+
+	app.Flag("format-override", "Force the format of files matching a gitignore-style pattern, e.g. '**/kubeconfig=yaml'. Can be repeated.").
+		StringsVar(&args.FormatOverrides)
+
+	app.Flag("changed-since", "Only check files added or modified between the given git ref and the working tree, e.g. origin/main.").
+		StringVar(&args.ChangedSince)
+
+	app.Flag("stdin-format", "Format of the file read from stdin. Determined from --stdin-filename if omitted.").
+		EnumVar(&args.StdinFormat, "yaml", "json", "ini", "dotenv")
+
+	app.Flag("stdin-filename", "Path to report for the file read from stdin, which is also used to match path-scoped rules.").
+		Default(Defaults.StdinFilename).
+		StringVar(&args.StdinFilename)
+
+	app.Flag("max-depth", "Maximum number of directory levels to search below each path, where 1 only includes files directly in the path. Unlimited by default.").
+		IntVar(&args.MaxDepth)
+
+	app.Flag("follow-symlinks", "Search symlinked directories. Symlinks pointing to one of their parent directories are skipped.").
+		BoolVar(&args.FollowSymlinks)
+
+	app.Flag("jobs", "Number of files to process concurrently. Defaults to the number of available CPUs.").
+		Short('j').
+		IntVar(&args.Jobs)
+
+	app.Flag("now", "Override the current time used to evaluate age-based rules, in RFC 3339 format, e.g. 2024-03-20T10:00:00Z.").
+		StringVar(&now)
+
+	// Commands.
+	check := app.Command("check", "Check SOPS files in a directory tree.").Default()
+	check.Arg("path", "Directories or files to run the checks in, or - to read a single file from stdin. If omitted, checks are run in the current working directory.").
+		Default(Defaults.CheckPaths...).
+		StringsVar(&args.CheckPaths)
+
+	var repositories []string
+
+	historyArgs := &HistoryArgs{}
+	history := app.Command("history", "Check all versions of SOPS files in the history of a git repository.")
+	history.Flag("range", "Git revision range to scan, e.g. v1.0..main.").
+		Default("HEAD").
+		StringVar(&historyArgs.Range)
+	history.Flag("since", "Only scan commits more recent than the given date.").
+		StringVar(&historyArgs.Since)
+	history.Flag("until", "Only scan commits older than the given date.").
+		StringVar(&historyArgs.Until)
+	history.Arg("path", "Directories within git repositories whose history is checked, which may also be subdirectories of a repository. If omitted, the current working directory is used.").
+		Default(Defaults.CheckPaths...).
+		StringsVar(&repositories)
 
-	if _, err := app.Parse(commandLine); err != nil {
+	command, err := app.Parse(commandLine)
+	if err != nil {
 		return nil, err
 	}
 
+	if command == history.FullCommand() {
+		args.CheckPaths = repositories
+		args.History = historyArgs
+	}
+
+	var stdinPaths int
+
+	for i, path := range args.CheckPaths {
+		// kingpin parses a lone - as an empty argument.
+		if path == "" {
+			path = StdinPath
+			args.CheckPaths[i] = path
+		}
+
+		if path == StdinPath {
+			stdinPaths++
+		}
+	}
+
+	if stdinPaths > 1 {
+		return nil, fmt.Errorf("path %s can only be passed once", StdinPath)
+	}
+
+	for _, report := range reports {
+		format, path, ok := strings.Cut(report, "=")
+		if !ok || path == "" {
+			return nil, fmt.Errorf("invalid value %q for --report: expected <format>=<path>", report)
+		}
+
+		if !slices.Contains(ReportFormats, format) {
+			return nil, fmt.Errorf("invalid value %q for --report: unknown format %q", report, format)
+		}
+
+		args.Reports = append(args.Reports, Report{Format: format, Path: path})
+	}
+
+	if args.Output == "" {
+		args.Output = detectOutput()
+		args.Reports = append(args.Reports, detectReports(args.Reports)...)
+	}
+
+	if now != "" {
+		t, err := time.Parse(time.RFC3339, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for --now: %w", err)
+		}
+
+		args.Now = t
+	}
+
 	return args, nil
 }
+
+// detectOutput returns the output format native to the CI system the app runs
+// in, based on the environment variables set by GitHub Actions.
+func detectOutput() string {
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		return OutputGitHub
+	}
+
+	return Defaults.Output
+}
+
+// detectReports returns the report files native to the CI system the app runs
+// in, based on the environment variables set by GitLab CI. GitLab CI expects
+// Code Quality reports in a file, so the human readable output is kept and the
+// report is written to GitLabCodeQualityReportPath instead, unless reports
+// already contain one.
+func detectReports(reports []Report) []Report {
+	if os.Getenv("GITLAB_CI") != "true" {
+		return nil
+	}
+
+	for _, r := range reports {
+		if r.Format == ReportGitLabCodeQuality {
+			return nil
+		}
+	}
+
+	return []Report{{Format: ReportGitLabCodeQuality, Path: GitLabCodeQualityReportPath}}
+}
@@ -2,19 +2,26 @@ package cli
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestParseArgs(t *testing.T) {
+	// The output format is detected from the CI environment.
+	t.Setenv("GITHUB_ACTIONS", "")
+	t.Setenv("GITLAB_CI", "")
+
 	t.Run("no args", func(t *testing.T) {
 		args, err := ParseArgs(nil)
 		require.NoError(t, err)
 
 		expected := &Args{
-			ConfigPath: Defaults.ConfigPath,
-			CheckPath:  Defaults.CheckPath,
+			ConfigPath:    Defaults.ConfigPath,
+			CheckPaths:    Defaults.CheckPaths,
+			StdinFilename: Defaults.StdinFilename,
+			Output:        Defaults.Output,
 		}
 
 		assert.Equal(t, expected, args)
@@ -25,13 +32,175 @@ func TestParseArgs(t *testing.T) {
 		require.NoError(t, err)
 
 		expected := &Args{
-			ConfigPath: "the-config.yaml",
-			CheckPath:  Defaults.CheckPath,
+			ConfigPath:    "the-config.yaml",
+			CheckPaths:    Defaults.CheckPaths,
+			StdinFilename: Defaults.StdinFilename,
+			Output:        Defaults.Output,
 		}
 
 		assert.Equal(t, expected, args)
 	})
 
+	t.Run("gitlab", func(t *testing.T) {
+		t.Setenv("GITLAB_CI", "true")
+
+		args, err := ParseArgs(nil)
+		require.NoError(t, err)
+		assert.Equal(t, OutputText, args.Output)
+		assert.Equal(t, []Report{{Format: ReportGitLabCodeQuality, Path: GitLabCodeQualityReportPath}}, args.Reports)
+
+		args, err = ParseArgs([]string{"--report", "gitlab-codequality=quality.json"})
+		require.NoError(t, err)
+		assert.Equal(t, []Report{{Format: ReportGitLabCodeQuality, Path: "quality.json"}}, args.Reports)
+
+		args, err = ParseArgs([]string{"--output", "gitlab-codequality"})
+		require.NoError(t, err)
+		assert.Equal(t, OutputGitLabCodeQuality, args.Output)
+		assert.Empty(t, args.Reports)
+	})
+
+	t.Run("output", func(t *testing.T) {
+		t.Setenv("GITHUB_ACTIONS", "true")
+
+		args, err := ParseArgs(nil)
+		require.NoError(t, err)
+		assert.Equal(t, OutputGitHub, args.Output)
+
+		args, err = ParseArgs([]string{"--output", "text"})
+		require.NoError(t, err)
+		assert.Equal(t, OutputText, args.Output)
+
+		args, err = ParseArgs([]string{"--output", "gitlab-codequality"})
+		require.NoError(t, err)
+		assert.Equal(t, OutputGitLabCodeQuality, args.Output)
+
+		_, err = ParseArgs([]string{"--output", "xml"})
+		require.Error(t, err)
+	})
+
+	t.Run("now", func(t *testing.T) {
+		args, err := ParseArgs([]string{"--now", "2024-03-20T10:00:00Z"})
+		require.NoError(t, err)
+
+		assert.Equal(t, time.Date(2024, 3, 20, 10, 0, 0, 0, time.UTC), args.Now)
+	})
+
+	t.Run("fail on malformed", func(t *testing.T) {
+		args, err := ParseArgs([]string{"--fail-on-malformed"})
+		require.NoError(t, err)
+
+		assert.True(t, args.FailOnMalformed)
+	})
+
+	t.Run("no lint creation rules", func(t *testing.T) {
+		args, err := ParseArgs([]string{"--no-lint-creation-rules"})
+		require.NoError(t, err)
+
+		assert.True(t, args.NoLintCreationRules)
+	})
+
+	t.Run("format overrides", func(t *testing.T) {
+		args, err := ParseArgs([]string{"--format-override", "**/kubeconfig=yaml", "--format-override", "*.enc=binary"})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"**/kubeconfig=yaml", "*.enc=binary"}, args.FormatOverrides)
+	})
+
+	t.Run("changed since", func(t *testing.T) {
+		args, err := ParseArgs([]string{"--changed-since", "origin/main"})
+		require.NoError(t, err)
+
+		assert.Equal(t, "origin/main", args.ChangedSince)
+	})
+
+	t.Run("jobs", func(t *testing.T) {
+		args, err := ParseArgs([]string{"-j", "4"})
+		require.NoError(t, err)
+
+		assert.Equal(t, 4, args.Jobs)
+	})
+
+	t.Run("ignores", func(t *testing.T) {
+		args, err := ParseArgs([]string{"--no-default-ignores", "--explain-ignore", "secrets/app.yaml", "-i", "a", "-i", "b"})
+		require.NoError(t, err)
+
+		assert.True(t, args.NoDefaultIgnores)
+		assert.Equal(t, "secrets/app.yaml", args.ExplainIgnore)
+		assert.Equal(t, []string{"a", "b"}, args.IgnoreFilePath)
+	})
+
+	t.Run("walk options", func(t *testing.T) {
+		args, err := ParseArgs([]string{"--max-depth", "2", "--follow-symlinks", "envs/", "charts/"})
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, args.MaxDepth)
+		assert.True(t, args.FollowSymlinks)
+		assert.Equal(t, []string{"envs/", "charts/"}, args.CheckPaths)
+	})
+
+	t.Run("stdin", func(t *testing.T) {
+		args, err := ParseArgs([]string{"--stdin-format", "json", "--stdin-filename", "prod/secret.json", "a.yaml", "-"})
+		require.NoError(t, err)
+
+		assert.Equal(t, "json", args.StdinFormat)
+		assert.Equal(t, "prod/secret.json", args.StdinFilename)
+		assert.Equal(t, []string{"a.yaml", StdinPath}, args.CheckPaths)
+	})
+
+	t.Run("invalid stdin format", func(t *testing.T) {
+		_, err := ParseArgs([]string{"--stdin-format", "toml", "-"})
+		require.Error(t, err)
+	})
+
+	t.Run("stdin passed twice", func(t *testing.T) {
+		_, err := ParseArgs([]string{"-", "-"})
+		require.ErrorContains(t, err, "path - can only be passed once")
+	})
+
+	t.Run("reports", func(t *testing.T) {
+		args, err := ParseArgs([]string{"--output", "json", "--report", "json=out/report.json", "--report", "sarif=report.sarif", "--report", "junit=junit.xml"})
+		require.NoError(t, err)
+
+		assert.Equal(t, OutputJSON, args.Output)
+		assert.Equal(t, []Report{
+			{Format: ReportJSON, Path: "out/report.json"},
+			{Format: ReportSARIF, Path: "report.sarif"},
+			{Format: ReportJUnit, Path: "junit.xml"},
+		}, args.Reports)
+	})
+
+	t.Run("invalid reports", func(t *testing.T) {
+		_, err := ParseArgs([]string{"--report", "report.json"})
+		require.ErrorContains(t, err, "expected <format>=<path>")
+
+		_, err = ParseArgs([]string{"--report", "xml=report.xml"})
+		require.ErrorContains(t, err, `unknown format "xml"`)
+
+		_, err = ParseArgs([]string{"--output", "xml"})
+		require.Error(t, err)
+	})
+
+	t.Run("history", func(t *testing.T) {
+		args, err := ParseArgs([]string{"history", "--range", "v1.0..main", "--since", "2024-01-01", "repo", "other/envs"})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"repo", "other/envs"}, args.CheckPaths)
+		assert.Equal(t, &HistoryArgs{Range: "v1.0..main", Since: "2024-01-01"}, args.History)
+	})
+
+	t.Run("explicit check command", func(t *testing.T) {
+		args, err := ParseArgs([]string{"check", "some/path"})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"some/path"}, args.CheckPaths)
+		assert.Nil(t, args.History)
+	})
+
+	t.Run("invalid now", func(t *testing.T) {
+		_, err := ParseArgs([]string{"--now", "yesterday"})
+		require.Error(t, err)
+	})
+
 	t.Run("invalid args", func(t *testing.T) {
 		_, err := ParseArgs([]string{"--nonexistent"})
 		require.Error(t, err)
@@ -4,29 +4,177 @@ package config
 import (
 	"fmt"
 	"io"
-	"net/http"
 	"net/url"
-	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/goccy/go-yaml"
+	"github.com/Bonial-International-GmbH/sops-check/internal/sops"
 )
 
 // Config represents the configuration for the sops-check.
 type Config struct {
-	AllowUnmatched bool   `json:"allowUnmatched"`
-	Rules          []Rule `json:"rules"`
+	// Extends contains paths or URLs of configuration files to extend. Local
+	// paths are resolved relative to the directory of the extending file.
+	Extends        []string `json:"extends,omitempty"`
+	AllowUnmatched bool     `json:"allowUnmatched"`
+	Rules          []Rule   `json:"rules"`
+	// Definitions contains named rules which can be referenced from other
+	// rules via `ref`.
+	Definitions  map[string]Rule `json:"definitions,omitempty"`
+	Paths        []string        `json:"paths,omitempty"`
+	ExcludePaths []string        `json:"excludePaths,omitempty"`
+	// Exclude contains gitignore-style patterns of file paths, relative to
+	// the checked directory, which are ignored entirely.
+	Exclude []string `json:"exclude,omitempty"`
+	// RequireEncrypted contains gitignore-style patterns of file paths which
+	// must be SOPS files. Matching files without SOPS metadata are reported.
+	RequireEncrypted []string `json:"requireEncrypted,omitempty"`
+	// Formats maps file extensions, e.g. `.enc` or `.json.sops`, to the
+	// format of SOPS files with that extension.
+	Formats map[string]string `json:"formats,omitempty"`
+	// CheckCreationRules enables reporting files whose key groups differ from
+	// those of the matching creation rule in the nearest .sops.yaml file.
+	CheckCreationRules bool `json:"checkCreationRules,omitempty"`
+
+	// allowUnmatchedSet indicates whether AllowUnmatched was explicitly set
+	// in the configuration file or any of the files it extends.
+	allowUnmatchedSet bool
+	// checkCreationRulesSet indicates whether CheckCreationRules was
+	// explicitly set in the configuration file or any of the files it
+	// extends.
+	checkCreationRulesSet bool
 }
 
 // Rule represents a single rule in the configuration.
 type Rule struct {
-	AllOf       []Rule `json:"allOf,omitempty"`
-	AnyOf       []Rule `json:"anyOf,omitempty"`
-	Match       string `json:"match,omitempty"`
-	MatchRegex  string `json:"matchRegex,omitempty"`
-	Not         *Rule  `json:"not,omitempty"`
-	OneOf       []Rule `json:"oneOf,omitempty"`
-	Description string `json:"description,omitempty"`
-	URL         string `json:"url,omitempty"`
+	AllOf              []Rule    `json:"allOf,omitempty"`
+	AnyOf              []Rule    `json:"anyOf,omitempty"`
+	AtLeast            *int      `json:"atLeast,omitempty"`
+	AtMost             *int      `json:"atMost,omitempty"`
+	Exactly            *int      `json:"exactly,omitempty"`
+	InAnyKeyGroup      *Rule     `json:"inAnyKeyGroup,omitempty"`
+	InEveryKeyGroup    *Rule     `json:"inEveryKeyGroup,omitempty"`
+	KeyGroups          *Range    `json:"keyGroups,omitempty"`
+	Match              string    `json:"match,omitempty"`
+	MatchKMS           *KMSMatch `json:"matchKms,omitempty"`
+	MatchRegex         string    `json:"matchRegex,omitempty"`
+	MatchType          string    `json:"matchType,omitempty"`
+	MaxKeyAge          string    `json:"maxKeyAge,omitempty"`
+	MaxLastModifiedAge string    `json:"maxLastModifiedAge,omitempty"`
+	Metadata           *Metadata `json:"metadata,omitempty"`
+	Not                *Rule     `json:"not,omitempty"`
+	OneOf              []Rule    `json:"oneOf,omitempty"`
+	Ref                string    `json:"ref,omitempty"`
+	Rules              []Rule    `json:"rules,omitempty"`
+	ShamirThreshold    *Range    `json:"shamirThreshold,omitempty"`
+	ID                 string    `json:"id,omitempty"`
+	Description        string    `json:"description,omitempty"`
+	URL                string    `json:"url,omitempty"`
+	Paths              []string  `json:"paths,omitempty"`
+	ExcludePaths       []string  `json:"excludePaths,omitempty"`
+	Severity           string    `json:"severity,omitempty"`
+}
+
+// Range defines an inclusive range of counts. A nil bound is unbounded.
+type Range struct {
+	Min *int `json:"min,omitempty"`
+	Max *int `json:"max,omitempty"`
+}
+
+// KMSMatch defines shell-style glob patterns to match the fields of AWS KMS
+// trust anchors against. Empty fields match any value.
+type KMSMatch struct {
+	Partition string `json:"partition,omitempty"`
+	Region    string `json:"region,omitempty"`
+	Account   string `json:"account,omitempty"`
+	Alias     string `json:"alias,omitempty"`
+	Key       string `json:"key,omitempty"`
+	Role      string `json:"role,omitempty"`
+}
+
+// Patterns returns the non-empty patterns keyed by trust anchor field name.
+func (m *KMSMatch) Patterns() map[string]string {
+	patterns := make(map[string]string)
+
+	for field, pattern := range map[string]string{
+		sops.FieldPartition: m.Partition,
+		sops.FieldRegion:    m.Region,
+		sops.FieldAccount:   m.Account,
+		sops.FieldAlias:     m.Alias,
+		sops.FieldKeyID:     m.Key,
+		sops.FieldRole:      m.Role,
+	} {
+		if pattern != "" {
+			patterns[field] = pattern
+		}
+	}
+
+	return patterns
+}
+
+// Presence values for metadata fields.
+const (
+	// PresenceRequired requires a metadata field to be set.
+	PresenceRequired = "required"
+	// PresenceForbidden requires a metadata field to be unset.
+	PresenceForbidden = "forbidden"
+)
+
+// Metadata defines requirements for SOPS metadata other than trust anchors.
+// All non-empty requirements must be satisfied.
+type Metadata struct {
+	EncryptedRegex          string   `json:"encryptedRegex,omitempty"`
+	EncryptedSuffix         string   `json:"encryptedSuffix,omitempty"`
+	UnencryptedRegex        string   `json:"unencryptedRegex,omitempty"`
+	UnencryptedSuffix       string   `json:"unencryptedSuffix,omitempty"`
+	EncryptedCommentRegex   string   `json:"encryptedCommentRegex,omitempty"`
+	UnencryptedCommentRegex string   `json:"unencryptedCommentRegex,omitempty"`
+	MACOnlyEncrypted        *bool    `json:"macOnlyEncrypted,omitempty"`
+	MinVersion              string   `json:"minVersion,omitempty"`
+	EncryptedKeys           []string `json:"encryptedKeys,omitempty"`
+}
+
+// Presence returns the non-empty presence requirements keyed by the name of
+// the metadata field as it appears in SOPS files.
+func (m *Metadata) Presence() map[string]string {
+	presence := make(map[string]string)
+
+	for field, value := range map[string]string{
+		"encrypted_regex":           m.EncryptedRegex,
+		"encrypted_suffix":          m.EncryptedSuffix,
+		"unencrypted_regex":         m.UnencryptedRegex,
+		"unencrypted_suffix":        m.UnencryptedSuffix,
+		"encrypted_comment_regex":   m.EncryptedCommentRegex,
+		"unencrypted_comment_regex": m.UnencryptedCommentRegex,
+	} {
+		if value != "" {
+			presence[field] = value
+		}
+	}
+
+	return presence
+}
+
+// empty returns true if m does not define any requirements.
+func (m *Metadata) empty() bool {
+	return len(m.Presence()) == 0 && m.MACOnlyEncrypted == nil && m.MinVersion == "" && len(m.EncryptedKeys) == 0
+}
+
+// ParseDuration parses a duration like time.ParseDuration, but additionally
+// supports a number of days with a `d` suffix, e.g. `365d`.
+func ParseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(s)
 }
 
 func isURL(str string) bool {
@@ -36,52 +184,24 @@ func isURL(str string) bool {
 
 // Load loads the configuration from a remote URL.
 func LoadURL(url string) (*Config, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch config from URL %q: %v", url, err)
-	}
-
-	defer resp.Body.Close()
-
-	return LoadReader(resp.Body)
+	return newLoader().loadURL(url)
 }
 
 // LoadFile loads the configuration from a local file.
 func LoadFile(filePath string) (*Config, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	return LoadReader(file)
+	return newLoader().loadFile(filePath)
 }
 
 // Load loads the configuration from the given path, which can be a URL or a local file path.
 func Load(path string) (*Config, error) {
-	if isURL(path) {
-		return LoadURL(path)
-	}
-	return LoadFile(path)
+	return newLoader().load(path)
 }
 
-// LoadReader loads the configuration from an io.Reader.
+// LoadReader loads the configuration from an io.Reader. Relative paths of
+// extended configuration files are resolved relative to the current working
+// directory.
 func LoadReader(reader io.Reader) (*Config, error) {
-	bytes, err := io.ReadAll(reader)
-	if err != nil {
-		return nil, err
-	}
-
-	var config Config
-	if err := yaml.Unmarshal(bytes, &config); err != nil {
-		return nil, err
-	}
-
-	if err := Validate(&config); err != nil {
-		return nil, err
-	}
-
-	return &config, nil
+	return newLoader().loadReader(reader, "")
 }
 
 // Validate validates a configuration.
@@ -92,6 +212,22 @@ func Validate(config *Config) error {
 		}
 	}
 
+	for name, definition := range config.Definitions {
+		if err := ValidateRule(&definition); err != nil {
+			return fmt.Errorf("invalid rule definition %q: %w", name, err)
+		}
+	}
+
+	for extension, format := range config.Formats {
+		if !strings.HasPrefix(extension, ".") {
+			return fmt.Errorf("file extension %q must start with a dot", extension)
+		}
+
+		if _, err := sops.ParseFormat(format); err != nil {
+			return fmt.Errorf("invalid format for extension %q: %w", extension, err)
+		}
+	}
+
 	return nil
 }
 
@@ -106,23 +242,104 @@ func bool2int(b bool) int {
 func ValidateRule(rule *Rule) error {
 	matchConditions := (bool2int(rule.Match != "") +
 		bool2int(rule.MatchRegex != "") +
+		bool2int(rule.MatchType != "") +
+		bool2int(rule.MatchKMS != nil) +
+		bool2int(rule.Metadata != nil) +
+		bool2int(rule.MaxKeyAge != "") +
+		bool2int(rule.MaxLastModifiedAge != "") +
 		bool2int(rule.Not != nil) +
 		bool2int(len(rule.AllOf) > 0) +
 		bool2int(len(rule.AnyOf) > 0) +
-		bool2int(len(rule.OneOf) > 0))
+		bool2int(len(rule.OneOf) > 0) +
+		bool2int(len(rule.Rules) > 0) +
+		bool2int(rule.Ref != "") +
+		bool2int(rule.KeyGroups != nil) +
+		bool2int(rule.ShamirThreshold != nil) +
+		bool2int(rule.InEveryKeyGroup != nil) +
+		bool2int(rule.InAnyKeyGroup != nil))
 
 	if matchConditions != 1 {
 		return fmt.Errorf("Rule must exactly one match condition, got %d", matchConditions)
 	}
 
+	if err := validateCounts(rule); err != nil {
+		return err
+	}
+
+	if rule.MatchType != "" && !slices.Contains(sops.KeyTypes, sops.KeyType(rule.MatchType)) {
+		return fmt.Errorf("matchType must be one of %v, got %q", sops.KeyTypes, rule.MatchType)
+	}
+
+	if rule.MatchKMS != nil && len(rule.MatchKMS.Patterns()) == 0 {
+		return fmt.Errorf("matchKms must define at least one pattern")
+	}
+
+	if rule.Metadata != nil {
+		if err := validateMetadata(rule.Metadata); err != nil {
+			return err
+		}
+	}
+
+	durations := []struct {
+		name  string
+		value string
+	}{
+		{"maxKeyAge", rule.MaxKeyAge},
+		{"maxLastModifiedAge", rule.MaxLastModifiedAge},
+	}
+
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+
+		duration, err := ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", d.name, err)
+		}
+
+		if duration <= 0 {
+			return fmt.Errorf("%s must be positive, got %q", d.name, d.value)
+		}
+	}
+
+	ranges := []struct {
+		name  string
+		value *Range
+	}{
+		{"keyGroups", rule.KeyGroups},
+		{"shamirThreshold", rule.ShamirThreshold},
+	}
+
+	for _, r := range ranges {
+		if r.value == nil {
+			continue
+		}
+
+		if err := validateRange(r.value); err != nil {
+			return fmt.Errorf("invalid %s: %w", r.name, err)
+		}
+	}
+
+	switch rule.Severity {
+	case "", "error", "warning", "note":
+	default:
+		return fmt.Errorf("severity must be one of error, warning or note, got %q", rule.Severity)
+	}
+
 	nestedRules := [][]Rule{
 		rule.AllOf,
 		rule.AnyOf,
 		rule.OneOf,
+		rule.Rules,
 	}
 
-	if rule.Not != nil {
-		if err := ValidateRule(rule.Not); err != nil {
+	for _, nestedRule := range []*Rule{rule.Not, rule.InEveryKeyGroup, rule.InAnyKeyGroup} {
+		if nestedRule == nil {
+			continue
+		}
+
+		if err := ValidateRule(nestedRule); err != nil {
 			return err
 		}
 	}
@@ -137,3 +354,83 @@ func ValidateRule(rule *Rule) error {
 
 	return nil
 }
+
+// validateMetadata validates the requirements of a metadata rule.
+func validateMetadata(metadata *Metadata) error {
+	if metadata.empty() {
+		return fmt.Errorf("metadata must define at least one requirement")
+	}
+
+	for field, presence := range metadata.Presence() {
+		if presence != PresenceRequired && presence != PresenceForbidden {
+			return fmt.Errorf("%s must be one of %s or %s, got %q", field, PresenceRequired, PresenceForbidden, presence)
+		}
+	}
+
+	return nil
+}
+
+// validateRange validates that a range defines at least one non-negative bound
+// and that min is not greater than max.
+func validateRange(r *Range) error {
+	if r.Min == nil && r.Max == nil {
+		return fmt.Errorf("at least one of min or max is required")
+	}
+
+	if (r.Min != nil && *r.Min < 0) || (r.Max != nil && *r.Max < 0) {
+		return fmt.Errorf("min and max must not be negative")
+	}
+
+	if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+		return fmt.Errorf("min (%d) must not be greater than max (%d)", *r.Min, *r.Max)
+	}
+
+	return nil
+}
+
+// validateCounts validates the atLeast, atMost and exactly fields of a rule.
+// These are only allowed in combination with a list of nested rules.
+func validateCounts(rule *Rule) error {
+	hasCounts := rule.AtLeast != nil || rule.AtMost != nil || rule.Exactly != nil
+
+	if len(rule.Rules) == 0 {
+		if hasCounts {
+			return fmt.Errorf("atLeast, atMost and exactly require nested rules")
+		}
+
+		return nil
+	}
+
+	if !hasCounts {
+		return fmt.Errorf("nested rules require one of atLeast, atMost or exactly")
+	}
+
+	if rule.Exactly != nil && (rule.AtLeast != nil || rule.AtMost != nil) {
+		return fmt.Errorf("exactly cannot be combined with atLeast or atMost")
+	}
+
+	counts := []struct {
+		name  string
+		value *int
+	}{
+		{"atLeast", rule.AtLeast},
+		{"atMost", rule.AtMost},
+		{"exactly", rule.Exactly},
+	}
+
+	for _, count := range counts {
+		if count.value == nil {
+			continue
+		}
+
+		if *count.value < 0 || *count.value > len(rule.Rules) {
+			return fmt.Errorf("%s must be between 0 and %d, got %d", count.name, len(rule.Rules), *count.value)
+		}
+	}
+
+	if rule.AtLeast != nil && rule.AtMost != nil && *rule.AtLeast > *rule.AtMost {
+		return fmt.Errorf("atLeast (%d) must not be greater than atMost (%d)", *rule.AtLeast, *rule.AtMost)
+	}
+
+	return nil
+}
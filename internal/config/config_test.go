@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -34,6 +36,76 @@ rules:
 	require.Equal(t, config.Rules[0].Match, "age1yt3tfqlfrwdwx0z0ynwplcr6qxcxfaqycuprpmy89nr83ltx74tqdpszlw")
 }
 
+func TestLoadConfigExtends(t *testing.T) {
+	t.Run("local files", func(t *testing.T) {
+		config, err := Load("testdata/extends/config.yaml")
+		require.NoError(t, err)
+		require.Len(t, config.Rules, 3)
+		require.Equal(t, "age1u79ltfzz5k79ex4mpl3r76p2532xex4mpl3z7vttctudr6gedn6ex4mpl3", config.Rules[0].Match)
+		require.Equal(t, "arn:aws:kms:eu-central-1:123456789012:alias/team-foo", config.Rules[1].Match)
+		require.Equal(t, "arn:aws:kms:eu-central-1:123456789012:alias/repo-key", config.Rules[2].Match)
+		require.True(t, config.AllowUnmatched)
+		require.Equal(t, []string{"testdata/"}, config.ExcludePaths)
+	})
+
+	t.Run("explicit settings take precedence", func(t *testing.T) {
+		config, err := LoadReader(strings.NewReader(`
+extends: [testdata/extends/shared/base.yaml]
+allowUnmatched: false
+excludePaths: [vendor/]`))
+		require.NoError(t, err)
+		require.Len(t, config.Rules, 1)
+		require.False(t, config.AllowUnmatched)
+		require.Equal(t, []string{"vendor/"}, config.ExcludePaths)
+	})
+
+	t.Run("diamond", func(t *testing.T) {
+		config, err := Load("testdata/extends/diamond/config.yaml")
+		require.NoError(t, err)
+		require.Len(t, config.Rules, 4)
+		require.Equal(t, "base", config.Rules[0].ID)
+		require.Equal(t, "a", config.Rules[1].Match)
+		require.Equal(t, "b", config.Rules[2].Match)
+		require.Equal(t, "config", config.Rules[3].Match)
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		_, err := Load("testdata/extends/cycle-a.yaml")
+		require.ErrorContains(t, err, "cycle detected")
+	})
+
+	t.Run("nonexistent file", func(t *testing.T) {
+		_, err := LoadReader(strings.NewReader(`extends: [testdata/extends/nonexistent.yaml]`))
+		require.ErrorContains(t, err, `failed to load extended config "testdata/extends/nonexistent.yaml"`)
+	})
+
+	t.Run("URL", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/policies/base.yaml", func(w http.ResponseWriter, _ *http.Request) {
+			fmt.Fprintln(w, `
+allowUnmatched: true
+rules:
+  - match: base`)
+		})
+		mux.HandleFunc("/policies/config.yaml", func(w http.ResponseWriter, _ *http.Request) {
+			fmt.Fprintln(w, `
+extends: [base.yaml]
+rules:
+  - match: team`)
+		})
+
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		config, err := Load(server.URL + "/policies/config.yaml")
+		require.NoError(t, err)
+		require.Len(t, config.Rules, 2)
+		require.Equal(t, "base", config.Rules[0].Match)
+		require.Equal(t, "team", config.Rules[1].Match)
+		require.True(t, config.AllowUnmatched)
+	})
+}
+
 func TestValidateConfig(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -58,6 +130,39 @@ func TestValidateConfig(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Config with invalid definition",
+			config: Config{
+				Definitions: map[string]Rule{
+					"some-definition": {},
+				},
+				Rules: []Rule{
+					{Ref: "some-definition"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Config with format mappings",
+			config: Config{
+				Formats: map[string]string{".enc": "binary", ".json.sops": "json"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Config with invalid format",
+			config: Config{
+				Formats: map[string]string{".enc": "toml"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Config with format mapping for extension without dot",
+			config: Config{
+				Formats: map[string]string{"enc": "yaml"},
+			},
+			wantErr: true,
+		},
 		{
 			name: "Config with more than one rule",
 			config: Config{
@@ -110,6 +215,150 @@ func TestValidateRule(t *testing.T) {
 			rule:    Rule{OneOf: []Rule{{Match: "first-match"}, {Match: "second-match"}}},
 			wantErr: false,
 		},
+		{
+			name:    "Valid AtLeast Rule",
+			rule:    Rule{AtLeast: intPtr(1), Rules: []Rule{{Match: "first-match"}, {Match: "second-match"}}},
+			wantErr: false,
+		},
+		{
+			name:    "Valid AtLeast and AtMost Rule",
+			rule:    Rule{AtLeast: intPtr(1), AtMost: intPtr(2), Rules: []Rule{{Match: "first-match"}, {Match: "second-match"}}},
+			wantErr: false,
+		},
+		{
+			name:    "Valid Exactly Rule",
+			rule:    Rule{Exactly: intPtr(2), Rules: []Rule{{Match: "first-match"}, {Match: "second-match"}}},
+			wantErr: false,
+		},
+		{
+			name:    "Nested rules without count",
+			rule:    Rule{Rules: []Rule{{Match: "first-match"}}},
+			wantErr: true,
+		},
+		{
+			name:    "Count without nested rules",
+			rule:    Rule{Match: "some-match", AtLeast: intPtr(1)},
+			wantErr: true,
+		},
+		{
+			name:    "Exactly combined with AtLeast",
+			rule:    Rule{Exactly: intPtr(1), AtLeast: intPtr(1), Rules: []Rule{{Match: "first-match"}}},
+			wantErr: true,
+		},
+		{
+			name:    "Count exceeds number of nested rules",
+			rule:    Rule{AtLeast: intPtr(3), Rules: []Rule{{Match: "first-match"}, {Match: "second-match"}}},
+			wantErr: true,
+		},
+		{
+			name:    "AtLeast greater than AtMost",
+			rule:    Rule{AtLeast: intPtr(2), AtMost: intPtr(1), Rules: []Rule{{Match: "first-match"}, {Match: "second-match"}}},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid nested rule",
+			rule:    Rule{AtLeast: intPtr(1), Rules: []Rule{{}}},
+			wantErr: true,
+		},
+		{
+			name:    "Valid MatchType Rule",
+			rule:    Rule{MatchType: "pgp"},
+			wantErr: false,
+		},
+		{
+			name:    "Invalid MatchType Rule",
+			rule:    Rule{MatchType: "rot13"},
+			wantErr: true,
+		},
+		{
+			name:    "Valid MatchKMS Rule",
+			rule:    Rule{MatchKMS: &KMSMatch{Account: "123456789012", Region: "eu-*"}},
+			wantErr: false,
+		},
+		{
+			name:    "Empty MatchKMS Rule",
+			rule:    Rule{MatchKMS: &KMSMatch{}},
+			wantErr: true,
+		},
+		{
+			name: "Valid Metadata Rule",
+			rule: Rule{Metadata: &Metadata{
+				EncryptedRegex:    PresenceRequired,
+				UnencryptedSuffix: PresenceForbidden,
+				MinVersion:        "3.8.0",
+			}},
+			wantErr: false,
+		},
+		{
+			name:    "Invalid Metadata Presence",
+			rule:    Rule{Metadata: &Metadata{EncryptedRegex: "yes"}},
+			wantErr: true,
+		},
+		{
+			name:    "Empty Metadata Rule",
+			rule:    Rule{Metadata: &Metadata{}},
+			wantErr: true,
+		},
+		{
+			name:    "Valid KeyGroups Rule",
+			rule:    Rule{KeyGroups: &Range{Min: intPtr(2)}},
+			wantErr: false,
+		},
+		{
+			name:    "Empty ShamirThreshold Range",
+			rule:    Rule{ShamirThreshold: &Range{}},
+			wantErr: true,
+		},
+		{
+			name:    "Inverted KeyGroups Range",
+			rule:    Rule{KeyGroups: &Range{Min: intPtr(3), Max: intPtr(2)}},
+			wantErr: true,
+		},
+		{
+			name:    "Valid InEveryKeyGroup Rule",
+			rule:    Rule{InEveryKeyGroup: &Rule{MatchType: "kms"}},
+			wantErr: false,
+		},
+		{
+			name:    "Invalid Nested InAnyKeyGroup Rule",
+			rule:    Rule{InAnyKeyGroup: &Rule{}},
+			wantErr: true,
+		},
+		{
+			name:    "Valid MaxKeyAge Rule",
+			rule:    Rule{MaxKeyAge: "365d"},
+			wantErr: false,
+		},
+		{
+			name:    "Valid MaxLastModifiedAge Rule",
+			rule:    Rule{MaxLastModifiedAge: "4320h"},
+			wantErr: false,
+		},
+		{
+			name:    "Invalid MaxKeyAge Rule",
+			rule:    Rule{MaxKeyAge: "one year"},
+			wantErr: true,
+		},
+		{
+			name:    "Non-positive MaxLastModifiedAge Rule",
+			rule:    Rule{MaxLastModifiedAge: "0d"},
+			wantErr: true,
+		},
+		{
+			name:    "Valid Ref Rule",
+			rule:    Rule{Ref: "some-definition"},
+			wantErr: false,
+		},
+		{
+			name:    "Valid Severity",
+			rule:    Rule{Match: "some-match", Severity: "warning"},
+			wantErr: false,
+		},
+		{
+			name:    "Invalid Severity",
+			rule:    Rule{Match: "some-match", Severity: "fatal"},
+			wantErr: true,
+		},
 		{
 			name:    "Multiple conditions",
 			rule:    Rule{Match: "some-match", AllOf: []Rule{{Match: "sub-match"}}},
@@ -130,3 +379,33 @@ func TestValidateRule(t *testing.T) {
 		})
 	}
 }
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{input: "365d", expected: 365 * 24 * time.Hour},
+		{input: "12h30m", expected: 12*time.Hour + 30*time.Minute},
+		{input: "1.5d", wantErr: true},
+		{input: "forever", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			d, err := ParseDuration(tt.input)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, d)
+		})
+	}
+}
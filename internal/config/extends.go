@@ -0,0 +1,253 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// loader loads configuration files and recursively resolves the
+// configuration files they extend.
+type loader struct {
+	// stack contains the locations of all configuration files that are
+	// currently being loaded. It is used to detect cycles.
+	stack []string
+	// loaded contains the locations of all extended configuration files
+	// that have been loaded. Files extended multiple times, e.g. a common
+	// base of two extended files, are only merged once.
+	loaded map[string]bool
+}
+
+func newLoader() *loader {
+	return &loader{loaded: make(map[string]bool)}
+}
+
+// load loads the configuration from the given location, which can be a URL or
+// a local file path.
+func (l *loader) load(location string) (*Config, error) {
+	if isURL(location) {
+		return l.loadURL(location)
+	}
+
+	return l.loadFile(location)
+}
+
+// loadURL loads the configuration from a remote URL.
+func (l *loader) loadURL(url string) (*Config, error) {
+	if err := l.push(url); err != nil {
+		return nil, err
+	}
+	defer l.pop()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch config from URL %q: %v", url, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch config from URL %q: unexpected status %s", url, resp.Status)
+	}
+
+	return l.loadReader(resp.Body, url)
+}
+
+// loadFile loads the configuration from a local file.
+func (l *loader) loadFile(filePath string) (*Config, error) {
+	absPath, err := absLocation(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.push(absPath); err != nil {
+		return nil, err
+	}
+	defer l.pop()
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return l.loadReader(file, absPath)
+}
+
+// loadReader loads the configuration from an io.Reader. The location is used
+// to resolve relative paths of extended configuration files. If empty, they
+// are resolved relative to the current working directory.
+func (l *loader) loadReader(reader io.Reader, location string) (*Config, error) {
+	bytes, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(bytes, &config); err != nil {
+		return nil, err
+	}
+
+	// Settings that are explicitly set take precedence over those of
+	// extended configuration files, so we need to know which ones are set.
+	var explicit struct {
+		AllowUnmatched     *bool `json:"allowUnmatched"`
+		CheckCreationRules *bool `json:"checkCreationRules"`
+	}
+	if err := yaml.Unmarshal(bytes, &explicit); err != nil {
+		return nil, err
+	}
+
+	config.allowUnmatchedSet = explicit.AllowUnmatched != nil
+	config.checkCreationRulesSet = explicit.CheckCreationRules != nil
+
+	merged := &Config{}
+
+	for _, ref := range config.Extends {
+		resolved, err := resolveLocation(location, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := absLocation(resolved)
+		if err != nil {
+			return nil, err
+		}
+
+		if l.loaded[key] {
+			continue
+		}
+
+		extended, err := l.load(resolved)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load extended config %q: %w", ref, err)
+		}
+
+		l.loaded[key] = true
+
+		merge(merged, extended)
+	}
+
+	merge(merged, &config)
+	merged.Extends = config.Extends
+
+	if err := Validate(merged); err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+// push adds location to the stack of configuration files being loaded. It
+// returns an error if the location is already on the stack.
+func (l *loader) push(location string) error {
+	if slices.Contains(l.stack, location) {
+		cycle := append(slices.Clone(l.stack), location)
+		return fmt.Errorf("cycle detected while extending config: %s", strings.Join(cycle, " -> "))
+	}
+
+	l.stack = append(l.stack, location)
+
+	return nil
+}
+
+// pop removes the last location from the stack of configuration files being
+// loaded.
+func (l *loader) pop() {
+	l.stack = l.stack[:len(l.stack)-1]
+}
+
+// absLocation returns the absolute path of a local configuration file, which
+// identifies it regardless of how it is referenced. URLs are returned as is.
+func absLocation(location string) (string, error) {
+	if isURL(location) {
+		return location, nil
+	}
+
+	return filepath.Abs(location)
+}
+
+// resolveLocation resolves the location of an extended configuration file
+// relative to the location of the extending one.
+func resolveLocation(base, ref string) (string, error) {
+	if isURL(ref) {
+		return ref, nil
+	}
+
+	if isURL(base) {
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			return "", err
+		}
+
+		refURL, err := url.Parse(ref)
+		if err != nil {
+			return "", fmt.Errorf("invalid config reference %q: %w", ref, err)
+		}
+
+		return baseURL.ResolveReference(refURL).String(), nil
+	}
+
+	if base == "" || filepath.IsAbs(ref) {
+		return ref, nil
+	}
+
+	return filepath.Join(filepath.Dir(base), ref), nil
+}
+
+// merge merges config into base. Rules of config are appended to those of
+// base, which means that all rules of all configuration files have to match.
+// Rule definitions and format mappings of config override those of base with
+// the same name. Other settings of config override those of base if they are set.
+func merge(base, config *Config) {
+	base.Rules = append(base.Rules, config.Rules...)
+
+	for name, definition := range config.Definitions {
+		if base.Definitions == nil {
+			base.Definitions = make(map[string]Rule)
+		}
+
+		base.Definitions[name] = definition
+	}
+
+	for extension, format := range config.Formats {
+		if base.Formats == nil {
+			base.Formats = make(map[string]string)
+		}
+
+		base.Formats[extension] = format
+	}
+
+	if config.allowUnmatchedSet {
+		base.AllowUnmatched = config.AllowUnmatched
+		base.allowUnmatchedSet = true
+	}
+
+	if config.checkCreationRulesSet {
+		base.CheckCreationRules = config.CheckCreationRules
+		base.checkCreationRulesSet = true
+	}
+
+	if len(config.Paths) > 0 {
+		base.Paths = config.Paths
+	}
+
+	if len(config.ExcludePaths) > 0 {
+		base.ExcludePaths = config.ExcludePaths
+	}
+
+	if len(config.Exclude) > 0 {
+		base.Exclude = config.Exclude
+	}
+
+	if len(config.RequireEncrypted) > 0 {
+		base.RequireEncrypted = config.RequireEncrypted
+	}
+}
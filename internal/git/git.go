@@ -0,0 +1,105 @@
+// Package git provides helpers for determining which files changed in a git
+// repository.
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ChangedFiles returns the paths of all files below dir that were added,
+// modified, renamed or copied between ref and the working tree, including
+// untracked files that are not ignored by git. Deleted files are omitted.
+// Returned paths are prefixed with dir, like the paths produced by walking
+// dir.
+func ChangedFiles(dir, ref string) ([]string, error) {
+	// --relative limits the diff to dir and makes paths relative to it.
+	diff, err := runGit(dir, "diff", "--name-status", "-z", "--find-renames", "--relative", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := parseNameStatus(diff)
+	if err != nil {
+		return nil, err
+	}
+
+	untracked, err := runGit(dir, "ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	changed = append(changed, splitNUL(untracked)...)
+
+	paths := make([]string, len(changed))
+	for i, path := range changed {
+		paths[i] = filepath.Join(dir, filepath.FromSlash(path))
+	}
+
+	return paths, nil
+}
+
+// parseNameStatus parses the output of `git diff --name-status -z` and returns
+// the current paths of all files that were not deleted. For renames and
+// copies, only the new path is returned.
+func parseNameStatus(output []byte) ([]string, error) {
+	var paths []string
+
+	fields := splitNUL(output)
+
+	for i := 0; i < len(fields); i++ {
+		status := fields[i]
+		if status == "" {
+			return nil, fmt.Errorf("unexpected empty status in git diff output")
+		}
+
+		switch status[0] {
+		case 'R', 'C':
+			// Renames and copies are followed by the old and the new path.
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("unexpected end of git diff output after status %q", status)
+			}
+
+			paths = append(paths, fields[i+2])
+			i += 2
+		case 'D':
+			i++
+		default:
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("unexpected end of git diff output after status %q", status)
+			}
+
+			paths = append(paths, fields[i+1])
+			i++
+		}
+	}
+
+	return paths, nil
+}
+
+// splitNUL splits NUL-terminated output into its fields.
+func splitNUL(output []byte) []string {
+	output = bytes.TrimSuffix(output, []byte{0})
+	if len(output) == 0 {
+		return nil
+	}
+
+	return strings.Split(string(output), "\x00")
+}
+
+func runGit(dir string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return output, nil
+}
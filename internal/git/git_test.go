@@ -0,0 +1,176 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNameStatus(t *testing.T) {
+	output := []byte("M\x00modified.yaml\x00A\x00added.yaml\x00D\x00deleted.yaml\x00R100\x00old.yaml\x00renamed.yaml\x00C075\x00source.yaml\x00copy.yaml\x00T\x00type.yaml\x00")
+
+	paths, err := parseNameStatus(output)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"modified.yaml", "added.yaml", "renamed.yaml", "copy.yaml", "type.yaml"}, paths)
+
+	_, err = parseNameStatus([]byte("R100\x00old.yaml\x00"))
+	assert.Error(t, err)
+}
+
+func TestChangedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+
+	writeFile := func(name, content string) {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	git("init", "-q")
+	writeFile("unchanged.yaml", "a: 1\n")
+	writeFile("modified.yaml", "b: 1\n")
+	writeFile("deleted.yaml", "c: 1\n")
+	writeFile("old.yaml", "d: 1\ne: 2\nf: 3\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	git("tag", "base")
+
+	writeFile("modified.yaml", "b: 2\n")
+	require.NoError(t, os.Remove(filepath.Join(dir, "deleted.yaml")))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0o700))
+	git("mv", "old.yaml", "sub/renamed.yaml")
+	writeFile("added.yaml", "g: 1\n")
+	git("add", "added.yaml")
+	git("commit", "-q", "-m", "change")
+	writeFile("untracked.yaml", "h: 1\n")
+
+	paths, err := ChangedFiles(dir, "base")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(dir, "added.yaml"),
+		filepath.Join(dir, "modified.yaml"),
+		filepath.Join(dir, "sub", "renamed.yaml"),
+		filepath.Join(dir, "untracked.yaml"),
+	}, paths)
+
+	_, err = ChangedFiles(dir, "nonexistent")
+	assert.ErrorContains(t, err, "git diff failed")
+}
+
+func TestParseRawDiff(t *testing.T) {
+	output := []byte(":000000 100644 0000000000000000000000000000000000000000 1111111111111111111111111111111111111111 A\x00added.yaml\x00" +
+		":100644 120000 2222222222222222222222222222222222222222 3333333333333333333333333333333333333333 T\x00symlink.yaml\x00" +
+		":100644 100755 4444444444444444444444444444444444444444 5555555555555555555555555555555555555555 M\x00dir/modified.yaml\x00")
+
+	blobs, err := parseRawDiff(output)
+	require.NoError(t, err)
+	assert.Equal(t, []Blob{
+		{ID: "1111111111111111111111111111111111111111", Path: "added.yaml"},
+		{ID: "5555555555555555555555555555555555555555", Path: "dir/modified.yaml"},
+	}, blobs)
+
+	_, err = parseRawDiff([]byte("garbage\x00"))
+	assert.Error(t, err)
+}
+
+func TestHistory(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+
+	writeFile := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+
+	git("init", "-q")
+	writeFile("a.yaml", "v: 1\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "first")
+	writeFile("a.yaml", "v: 2\n\n")
+	writeFile("b.yaml", "w: 1\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "second")
+	git("rm", "-q", "b.yaml")
+	git("commit", "-q", "-m", "third")
+
+	commits, err := Commits(dir, "HEAD", "", "")
+	require.NoError(t, err)
+	require.Len(t, commits, 3)
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o700))
+
+	top, err := TopLevel(filepath.Join(dir, "sub"))
+	require.NoError(t, err)
+
+	expectedTop, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+	assert.Equal(t, expectedTop, top)
+
+	first, err := ChangedBlobs(dir, commits[0])
+	require.NoError(t, err)
+	require.Len(t, first, 1)
+	assert.Equal(t, "a.yaml", first[0].Path)
+
+	second, err := ChangedBlobs(dir, commits[1])
+	require.NoError(t, err)
+	require.Len(t, second, 2)
+
+	third, err := ChangedBlobs(dir, commits[2])
+	require.NoError(t, err)
+	assert.Empty(t, third)
+
+	reader, err := NewBlobReader(dir)
+	require.NoError(t, err)
+
+	data, err := reader.Read(first[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "v: 1\n", string(data))
+
+	data, err = reader.Read(second[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "v: 2\n\n", string(data))
+
+	_, err = reader.Read("0000000000000000000000000000000000000000")
+	assert.ErrorContains(t, err, "missing")
+
+	require.NoError(t, reader.Close())
+
+	commits, err = Commits(dir, commits[0]+"..HEAD", "", "")
+	require.NoError(t, err)
+	assert.Len(t, commits, 2)
+
+	// Merge commits are compared to their first parent.
+	git("checkout", "-q", "-b", "feature")
+	writeFile("c.yaml", "x: 1\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "feature")
+	git("checkout", "-q", "-")
+	git("merge", "-q", "--no-ff", "-m", "merge", "feature")
+
+	merged, err := ChangedBlobs(dir, "HEAD")
+	require.NoError(t, err)
+	require.Len(t, merged, 1)
+	assert.Equal(t, "c.yaml", merged[0].Path)
+}
@@ -0,0 +1,163 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Blob is a version of a file in the history of a repository.
+type Blob struct {
+	// ID is the object name of the blob.
+	ID string
+	// Path is the path of the file relative to the repository root.
+	Path string
+}
+
+// TopLevel returns the absolute path of the top-level directory of the work
+// tree containing dir, which the paths of blobs are relative to.
+func TopLevel(dir string) (string, error) {
+	output, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.FromSlash(strings.TrimSpace(string(output))), nil
+}
+
+// Commits returns the commits of the repository in dir that are reachable
+// from revisionRange, e.g. `HEAD` or `v1.0..main`, oldest first. Since and
+// until optionally bound the commit dates and accept any date format git
+// understands.
+func Commits(dir, revisionRange, since, until string) ([]string, error) {
+	args := []string{"rev-list", "--reverse"}
+
+	if since != "" {
+		args = append(args, "--since="+since)
+	}
+
+	if until != "" {
+		args = append(args, "--until="+until)
+	}
+
+	args = append(args, revisionRange, "--")
+
+	output, err := runGit(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(string(output)), nil
+}
+
+// ChangedBlobs returns the blobs of all regular files that commit added or
+// modified compared to its first parent, so that merge commits include the
+// changes they merged. For root commits, all files are returned.
+func ChangedBlobs(dir, commit string) ([]Blob, error) {
+	output, err := runGit(dir, "diff-tree", "-r", "-z", "--root", "-m", "--first-parent", "--no-commit-id", "--no-renames", "--diff-filter=AMT", commit)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRawDiff(output)
+}
+
+// parseRawDiff parses the output of `git diff-tree -r -z` and returns the new
+// blobs of all regular files.
+func parseRawDiff(output []byte) ([]Blob, error) {
+	var blobs []Blob
+
+	fields := splitNUL(output)
+
+	for i := 0; i < len(fields); i += 2 {
+		// Each entry consists of `:<old mode> <new mode> <old id> <new id>
+		// <status>` followed by the path.
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(meta) != 5 || i+1 >= len(fields) {
+			return nil, fmt.Errorf("unexpected git diff-tree output: %q", fields[i])
+		}
+
+		// Skip symlinks and submodules.
+		if mode := meta[1]; mode != "100644" && mode != "100755" {
+			continue
+		}
+
+		blobs = append(blobs, Blob{ID: meta[3], Path: fields[i+1]})
+	}
+
+	return blobs, nil
+}
+
+// BlobReader reads the contents of blobs from a repository using a single
+// long-running `git cat-file` process.
+type BlobReader struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// NewBlobReader starts a BlobReader for the repository in dir. It must be
+// closed after use.
+func NewBlobReader(dir string) (*BlobReader, error) {
+	cmd := exec.Command("git", "-C", dir, "cat-file", "--batch")
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("git cat-file failed: %w", err)
+	}
+
+	return &BlobReader{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+// Read returns the contents of the blob with the given id.
+func (r *BlobReader) Read(id string) ([]byte, error) {
+	if _, err := fmt.Fprintln(r.stdin, id); err != nil {
+		return nil, err
+	}
+
+	// The header has the form `<id> <type> <size>`, or `<id> missing`.
+	header, err := r.stdout.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(header)
+	if len(fields) != 3 || fields[1] != "blob" {
+		return nil, fmt.Errorf("failed to read blob %s: %s", id, strings.TrimSpace(header))
+	}
+
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", id, err)
+	}
+
+	// The contents are followed by a newline.
+	data := make([]byte, size+1)
+	if _, err := io.ReadFull(r.stdout, data); err != nil {
+		return nil, err
+	}
+
+	return data[:size], nil
+}
+
+// Close stops the underlying git process.
+func (r *BlobReader) Close() error {
+	if err := r.stdin.Close(); err != nil {
+		return err
+	}
+
+	return r.cmd.Wait()
+}
@@ -0,0 +1,424 @@
+// Package ignore decides which paths sops-check ignores, using gitignore-style
+// pattern files.
+package ignore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+const (
+	// GitignoreFileName is the name of the per-directory ignore files of git.
+	GitignoreFileName = ".gitignore"
+	// DefaultIgnoreFileName is the name of the ignore file which is read
+	// from the root directory by default.
+	DefaultIgnoreFileName = ".sops-checkignore"
+
+	gitDirName = ".git"
+)
+
+// Options configure a Matcher.
+type Options struct {
+	// Root is the directory being checked.
+	Root string
+	// IgnoreFiles contains paths of additional ignore files. Their patterns
+	// are relative to Root, so that ignore files can be kept outside of the
+	// checked directory.
+	IgnoreFiles []string
+	// Exclude contains additional patterns which are relative to Root.
+	Exclude []string
+	// NoDefaults disables reading .gitignore files and the .sops-checkignore
+	// file in Root, and skipping .git directories.
+	NoDefaults bool
+}
+
+// Matcher decides whether paths are ignored. Like git, it honors nested
+// .gitignore files, whose patterns are relative to their directory, with
+// deeper files taking precedence. Patterns from ignore files passed
+// explicitly, the .sops-checkignore file and exclude patterns take precedence
+// over .gitignore files, so they can re-include files ignored by git. A path
+// is always ignored if one of its parent directories is ignored. Like git,
+// .git directories are ignored as well.
+//
+// A nil Matcher does not ignore anything. A Matcher is not safe for
+// concurrent use.
+type Matcher struct {
+	cwd string
+	// top is the directory above which no .gitignore files are read. It is
+	// the top-level directory of the git work tree containing Root, or Root
+	// itself if it is not part of a work tree.
+	top       string
+	gitignore bool
+	// sources contains the pattern files which take precedence over
+	// .gitignore files, in order of decreasing precedence.
+	sources []*patternFile
+	// gitignores caches the .gitignore file of each directory, which is nil
+	// if the directory does not contain one.
+	gitignores map[string]*patternFile
+	// dirs caches the explanations for directories.
+	dirs map[string]*Explanation
+}
+
+// New creates a Matcher from opts.
+func New(opts Options) (*Matcher, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	root := absPath(cwd, opts.Root)
+
+	m := &Matcher{
+		cwd:        cwd,
+		top:        root,
+		gitignore:  !opts.NoDefaults,
+		gitignores: make(map[string]*patternFile),
+		dirs:       make(map[string]*Explanation),
+	}
+
+	for _, ignoreFile := range opts.IgnoreFiles {
+		source, err := loadPatternFile(root, absPath(cwd, ignoreFile), ignoreFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process ignore file %s: %w", ignoreFile, err)
+		}
+
+		m.sources = append(m.sources, source)
+	}
+
+	if !opts.NoDefaults {
+		path := filepath.Join(root, DefaultIgnoreFileName)
+
+		source, err := loadPatternFile(root, path, filepath.Join(opts.Root, DefaultIgnoreFileName))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to process ignore file %s: %w", path, err)
+		}
+
+		if source != nil {
+			m.sources = append(m.sources, source)
+		}
+
+		m.top = workTreeTop(root)
+	}
+
+	if len(opts.Exclude) > 0 {
+		m.sources = append(m.sources, newPatternFile(root, opts.Exclude, func(i int) string {
+			return fmt.Sprintf("exclude[%d] of the config", i)
+		}))
+	}
+
+	return m, nil
+}
+
+// Match returns true if the file or directory at path is ignored.
+func (m *Matcher) Match(path string, isDir bool) (bool, error) {
+	if m == nil {
+		return false, nil
+	}
+
+	explanation, err := m.explain(absPath(m.cwd, path), isDir)
+	if err != nil {
+		return false, err
+	}
+
+	return explanation.Ignored, nil
+}
+
+// Explain describes whether the file or directory at path is ignored, and
+// why.
+func (m *Matcher) Explain(path string) (*Explanation, error) {
+	if m == nil {
+		return &Explanation{}, nil
+	}
+
+	info, err := os.Stat(path)
+	isDir := err == nil && info.IsDir()
+
+	return m.explain(absPath(m.cwd, path), isDir)
+}
+
+// Explanation describes whether a path is ignored, and why.
+type Explanation struct {
+	// Ignored is true if the path is ignored.
+	Ignored bool
+	// Dir is the path of the parent directory which causes the path to be
+	// ignored. It is empty if the path is not ignored because of one of its
+	// parent directories.
+	Dir string
+	// Origin describes where the pattern which decided whether the path is
+	// ignored comes from, e.g. `.gitignore:3`. It is empty if no pattern
+	// matches the path.
+	Origin string
+	// Pattern is the pattern which decided whether the path is ignored.
+	Pattern string
+}
+
+// String returns a human readable description of the explanation.
+func (e *Explanation) String() string {
+	switch {
+	case e.Origin == "":
+		return "not ignored, because no pattern matches it"
+	case e.Dir != "":
+		return fmt.Sprintf("ignored, because its parent directory %s is ignored by %s: %s", e.Dir, e.Origin, e.Pattern)
+	case e.Ignored:
+		return fmt.Sprintf("ignored by %s: %s", e.Origin, e.Pattern)
+	default:
+		return fmt.Sprintf("not ignored, because it is re-included by %s: %s", e.Origin, e.Pattern)
+	}
+}
+
+func (m *Matcher) explain(path string, isDir bool) (*Explanation, error) {
+	if isDir {
+		if explanation, ok := m.dirs[path]; ok {
+			return explanation, nil
+		}
+	}
+
+	explanation, err := m.explainUncached(path, isDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if isDir {
+		m.dirs[path] = explanation
+	}
+
+	return explanation, nil
+}
+
+func (m *Matcher) explainUncached(path string, isDir bool) (*Explanation, error) {
+	dir := filepath.Dir(path)
+
+	// Like git, never descend into ignored directories.
+	if dir != path && isWithin(m.top, dir) && dir != m.top {
+		parent, err := m.explain(dir, true)
+		if err != nil {
+			return nil, err
+		}
+
+		if parent.Ignored {
+			explanation := *parent
+			if explanation.Dir == "" {
+				explanation.Dir = m.display(dir)
+			}
+
+			return &explanation, nil
+		}
+	}
+
+	// Git repositories are never checked, unless defaults are disabled.
+	if m.gitignore && isDir && filepath.Base(path) == gitDirName {
+		return &Explanation{Ignored: true, Origin: "default", Pattern: gitDirName + "/"}, nil
+	}
+
+	for _, source := range m.sources {
+		if p := source.match(path, isDir); p != nil {
+			return p.explanation(), nil
+		}
+	}
+
+	if !m.gitignore || !isWithin(m.top, path) {
+		return &Explanation{}, nil
+	}
+
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		source, err := m.loadGitignore(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		if p := source.match(path, isDir); p != nil {
+			return p.explanation(), nil
+		}
+
+		if dir == m.top {
+			return &Explanation{}, nil
+		}
+	}
+}
+
+// loadGitignore returns the .gitignore file of dir, or nil if it does not
+// contain one.
+func (m *Matcher) loadGitignore(dir string) (*patternFile, error) {
+	if source, ok := m.gitignores[dir]; ok {
+		return source, nil
+	}
+
+	path := filepath.Join(dir, GitignoreFileName)
+
+	source, err := loadPatternFile(dir, path, m.display(path))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to process ignore file %s: %w", path, err)
+	}
+
+	m.gitignores[dir] = source
+
+	return source, nil
+}
+
+// display returns path relative to the working directory if possible, to
+// keep explanations short.
+func (m *Matcher) display(path string) string {
+	if rel, err := filepath.Rel(m.cwd, path); err == nil && isWithin(m.cwd, path) {
+		return rel
+	}
+
+	return path
+}
+
+// patternFile is a list of gitignore-style patterns which are relative to
+// dir.
+type patternFile struct {
+	dir      string
+	patterns []*pattern
+}
+
+type pattern struct {
+	matcher *gitignore.GitIgnore
+	negate  bool
+	dirOnly bool
+	origin  string
+	line    string
+}
+
+// loadPatternFile loads the patterns of the ignore file at path, which are
+// relative to dir. Patterns are identified by name and line number.
+func loadPatternFile(dir, path, name string) (*patternFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(string(data), "\n")
+
+	return newPatternFile(dir, lines, func(i int) string {
+		return fmt.Sprintf("%s:%d", name, i+1)
+	}), nil
+}
+
+func newPatternFile(dir string, lines []string, origin func(int) string) *patternFile {
+	source := &patternFile{dir: dir}
+
+	for i, line := range lines {
+		text := strings.TrimSpace(strings.TrimRight(line, "\r"))
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		negate := strings.HasPrefix(text, "!")
+		expr := strings.TrimPrefix(text, "!")
+
+		expr = anchor(expr)
+
+		source.patterns = append(source.patterns, &pattern{
+			matcher: gitignore.CompileIgnoreLines(expr),
+			negate:  negate,
+			dirOnly: strings.HasSuffix(expr, "/"),
+			origin:  origin(i),
+			line:    text,
+		})
+	}
+
+	return source
+}
+
+// CompilePatterns compiles gitignore-style patterns, which are relative to
+// the root of the matched paths. Unlike the gitignore library, it anchors
+// patterns like git does.
+func CompilePatterns(patterns ...string) *gitignore.GitIgnore {
+	lines := make([]string, len(patterns))
+
+	for i, p := range patterns {
+		if negated, ok := strings.CutPrefix(p, "!"); ok {
+			lines[i] = "!" + anchor(negated)
+		} else {
+			lines[i] = anchor(p)
+		}
+	}
+
+	return gitignore.CompileIgnoreLines(lines...)
+}
+
+// anchor anchors pattern to the directory it is relative to if it contains a
+// slash anywhere but at the end, like git does. The gitignore library does not
+// do this for all patterns, e.g. `envs/production/**` would match
+// `other/envs/production/secret.yaml` as well.
+func anchor(pattern string) string {
+	if trimmed := strings.TrimSuffix(pattern, "/"); strings.Contains(trimmed, "/") && !strings.HasPrefix(pattern, "/") && !strings.HasPrefix(pattern, "**/") {
+		return "/" + pattern
+	}
+
+	return pattern
+}
+
+// match returns the last pattern matching path, or nil if no pattern matches
+// it. It is safe to call on a nil patternFile.
+func (f *patternFile) match(path string, isDir bool) *pattern {
+	if f == nil || !isWithin(f.dir, path) {
+		return nil
+	}
+
+	rel, err := filepath.Rel(f.dir, path)
+	if err != nil {
+		return nil
+	}
+
+	rel = filepath.ToSlash(rel)
+
+	for i := len(f.patterns) - 1; i >= 0; i-- {
+		p := f.patterns[i]
+
+		candidate := rel
+		if isDir && p.dirOnly {
+			candidate += "/"
+		}
+
+		if p.matcher.MatchesPath(candidate) {
+			return p
+		}
+	}
+
+	return nil
+}
+
+func (p *pattern) explanation() *Explanation {
+	return &Explanation{
+		Ignored: !p.negate,
+		Origin:  p.origin,
+		Pattern: p.line,
+	}
+}
+
+// workTreeTop returns the top-level directory of the git work tree containing
+// dir, or dir itself if it is not part of a work tree.
+func workTreeTop(dir string) string {
+	for current := dir; ; current = filepath.Dir(current) {
+		if _, err := os.Lstat(filepath.Join(current, gitDirName)); err == nil {
+			return current
+		}
+
+		if parent := filepath.Dir(current); parent == current {
+			return dir
+		}
+	}
+}
+
+// isWithin returns true if path is dir or is located within dir.
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func absPath(cwd, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+
+	return filepath.Join(cwd, path)
+}
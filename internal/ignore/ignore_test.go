@@ -0,0 +1,178 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	root := t.TempDir()
+
+	writeFiles(t, root, map[string]string{
+		".gitignore":        "# comment\n*.log\nbuild/\n/top.yaml\nsub/anchored.yaml\ngenerated.yaml\n",
+		"sub/.gitignore":    "!keep.log\nlocal.yaml\n",
+		".sops-checkignore": "!generated.yaml\n",
+	})
+
+	matcher, err := New(Options{Root: root, Exclude: []string{"vendor/"}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{path: "a.log", ignored: true},
+		{path: "sub/a.log", ignored: true},
+		{path: "sub/keep.log", ignored: false},
+		{path: "build", isDir: true, ignored: true},
+		{path: "build", ignored: false},
+		{path: "build/x.yaml", ignored: true},
+		{path: "top.yaml", ignored: true},
+		{path: "sub/top.yaml", ignored: false},
+		{path: "sub/anchored.yaml", ignored: true},
+		{path: "other/sub/anchored.yaml", ignored: false},
+		{path: "sub/local.yaml", ignored: true},
+		{path: "local.yaml", ignored: false},
+		{path: "generated.yaml", ignored: false},
+		{path: "vendor/a.yaml", ignored: true},
+		{path: "secret.yaml", ignored: false},
+		{path: ".git", isDir: true, ignored: true},
+		{path: "sub/.git", isDir: true, ignored: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			ignored, err := matcher.Match(filepath.Join(root, test.path), test.isDir)
+			require.NoError(t, err)
+			assert.Equal(t, test.ignored, ignored)
+		})
+	}
+}
+
+func TestMatcherNoDefaults(t *testing.T) {
+	root := t.TempDir()
+
+	writeFiles(t, root, map[string]string{
+		".gitignore":        "*.log\n",
+		".sops-checkignore": "*.yaml\n",
+		"ignorefile":        "*.json\n",
+	})
+
+	matcher, err := New(Options{
+		Root:        root,
+		IgnoreFiles: []string{filepath.Join(root, "ignorefile")},
+		Exclude:     []string{"vendor/"},
+		NoDefaults:  true,
+	})
+	require.NoError(t, err)
+
+	for path, expected := range map[string]bool{
+		"a.log":         false,
+		"a.yaml":        false,
+		"a.json":        true,
+		"vendor/a.yaml": true,
+		".git/a.yaml":   false,
+	} {
+		ignored, err := matcher.Match(filepath.Join(root, path), false)
+		require.NoError(t, err)
+		assert.Equal(t, expected, ignored, path)
+	}
+}
+
+func TestMatcherWorkTree(t *testing.T) {
+	top := t.TempDir()
+
+	writeFiles(t, top, map[string]string{
+		".gitignore":      "*.log\n",
+		"envs/.gitignore": "/local.yaml\n",
+	})
+	require.NoError(t, os.Mkdir(filepath.Join(top, ".git"), 0o700))
+
+	matcher, err := New(Options{Root: filepath.Join(top, "envs")})
+	require.NoError(t, err)
+
+	for path, expected := range map[string]bool{
+		"envs/a.log":           true,
+		"envs/local.yaml":      true,
+		"envs/prod/local.yaml": false,
+	} {
+		ignored, err := matcher.Match(filepath.Join(top, path), false)
+		require.NoError(t, err)
+		assert.Equal(t, expected, ignored, path)
+	}
+}
+
+func TestMatcherExplain(t *testing.T) {
+	root := t.TempDir()
+
+	writeFiles(t, root, map[string]string{
+		".gitignore":        "build/\n*.log\n",
+		".sops-checkignore": "!keep.log\n",
+		"build/x.yaml":      "",
+	})
+
+	matcher, err := New(Options{Root: root})
+	require.NoError(t, err)
+
+	explain := func(path string) *Explanation {
+		explanation, err := matcher.Explain(filepath.Join(root, path))
+		require.NoError(t, err)
+		return explanation
+	}
+
+	explanation := explain("a.log")
+	assert.True(t, explanation.Ignored)
+	assert.Equal(t, "*.log", explanation.Pattern)
+	assert.Contains(t, explanation.String(), "ignored by ")
+	assert.Contains(t, explanation.String(), ".gitignore:2: *.log")
+
+	explanation = explain("build/x.yaml")
+	assert.True(t, explanation.Ignored)
+	assert.Equal(t, "build/", explanation.Pattern)
+	assert.Contains(t, explanation.String(), "because its parent directory ")
+
+	explanation = explain("keep.log")
+	assert.False(t, explanation.Ignored)
+	assert.Contains(t, explanation.String(), "re-included by ")
+	assert.Contains(t, explanation.String(), ".sops-checkignore:1: !keep.log")
+
+	explanation = explain("secret.yaml")
+	assert.False(t, explanation.Ignored)
+	assert.Equal(t, "not ignored, because no pattern matches it", explanation.String())
+}
+
+func TestNilMatcher(t *testing.T) {
+	var matcher *Matcher
+
+	ignored, err := matcher.Match("a.log", false)
+	require.NoError(t, err)
+	assert.False(t, ignored)
+}
+
+func TestCompilePatterns(t *testing.T) {
+	patterns := CompilePatterns("envs/production/**", "*.legacy.yaml", "!keep.legacy.yaml")
+
+	for path, expected := range map[string]bool{
+		"envs/production/secret.yaml":       true,
+		"other/envs/production/secret.yaml": false,
+		"a/b.legacy.yaml":                   true,
+		"a/keep.legacy.yaml":                false,
+	} {
+		assert.Equal(t, expected, patterns.MatchesPath(path), path)
+	}
+}
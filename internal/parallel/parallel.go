@@ -0,0 +1,95 @@
+// Package parallel provides helpers for processing items concurrently.
+package parallel
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Jobs returns the number of workers to use for the requested number of
+// jobs. Non-positive values default to GOMAXPROCS.
+func Jobs(jobs int) int {
+	if jobs < 1 {
+		return runtime.GOMAXPROCS(0)
+	}
+
+	return jobs
+}
+
+// Map runs a pipeline which processes all items emitted by produce with a
+// bounded pool of workers. The producer runs concurrently to the workers.
+// Results are returned in the order in which the items were emitted,
+// regardless of the order in which they are processed. The error returned by
+// produce is returned alongside the results of all items emitted before.
+func Map[T, R any](jobs int, produce func(emit func(T)) error, process func(T) R) ([]R, error) {
+	type job struct {
+		index int
+		item  T
+	}
+
+	type result struct {
+		index int
+		value R
+	}
+
+	jobCh := make(chan job)
+	resultCh := make(chan result)
+
+	var produceErr error
+
+	go func() {
+		defer close(jobCh)
+
+		index := 0
+
+		produceErr = produce(func(item T) {
+			jobCh <- job{index: index, item: item}
+			index++
+		})
+	}()
+
+	var wg sync.WaitGroup
+
+	for range Jobs(jobs) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := range jobCh {
+				resultCh <- result{index: j.index, value: process(j.item)}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	var results []R
+
+	for r := range resultCh {
+		if r.index >= len(results) {
+			results = append(results, make([]R, r.index-len(results)+1)...)
+		}
+
+		results[r.index] = r.value
+	}
+
+	return results, produceErr
+}
+
+// MapSlice processes all items with a bounded pool of workers and returns the
+// results in the order of items.
+func MapSlice[T, R any](jobs int, items []T, process func(T) R) []R {
+	results, _ := Map(jobs, func(emit func(T)) error {
+		for _, item := range items {
+			emit(item)
+		}
+
+		return nil
+	}, process)
+
+	return results
+}
@@ -0,0 +1,69 @@
+package parallel
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMap(t *testing.T) {
+	t.Run("preserves order", func(t *testing.T) {
+		items := make([]int, 100)
+		for i := range items {
+			items[i] = i
+		}
+
+		results := MapSlice(8, items, func(i int) int {
+			// Make earlier items finish last.
+			time.Sleep(time.Duration(100-i) * 10 * time.Microsecond)
+			return i * i
+		})
+
+		require.Len(t, results, len(items))
+		for i, result := range results {
+			assert.Equal(t, i*i, result)
+		}
+	})
+
+	t.Run("bounded workers", func(t *testing.T) {
+		var running, maxRunning atomic.Int32
+
+		MapSlice(3, make([]int, 50), func(int) int {
+			n := running.Add(1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+
+			time.Sleep(time.Millisecond)
+			running.Add(-1)
+
+			return 0
+		})
+
+		assert.LessOrEqual(t, maxRunning.Load(), int32(3))
+	})
+
+	t.Run("producer error", func(t *testing.T) {
+		results, err := Map(2, func(emit func(string)) error {
+			emit("a")
+			emit("b")
+			return errors.New("boom")
+		}, func(s string) string {
+			return s + s
+		})
+
+		assert.EqualError(t, err, "boom")
+		assert.Equal(t, []string{"aa", "bb"}, results)
+	})
+
+	t.Run("no items", func(t *testing.T) {
+		assert.Empty(t, MapSlice(0, nil, func(i int) int { return i }))
+	})
+}
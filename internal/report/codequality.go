@@ -0,0 +1,77 @@
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/Bonial-International-GmbH/sops-check/internal/rules"
+)
+
+// codeQualityIssue is an issue in a GitLab Code Quality report.
+type codeQualityIssue struct {
+	Description string              `json:"description"`
+	CheckName   string              `json:"check_name"`
+	Fingerprint string              `json:"fingerprint"`
+	Severity    string              `json:"severity"`
+	Location    codeQualityLocation `json:"location"`
+}
+
+type codeQualityLocation struct {
+	Path  string           `json:"path"`
+	Lines codeQualityLines `json:"lines"`
+}
+
+type codeQualityLines struct {
+	Begin int `json:"begin"`
+}
+
+// WriteCodeQuality writes the SARIF results of the report as a GitLab Code
+// Quality report to w, which GitLab shows on the affected lines of merge
+// requests. Results without a region point at the first line of their file.
+func (r *Report) WriteCodeQuality(w io.Writer) error {
+	issues := []codeQualityIssue{}
+
+	for _, result := range r.SarifResults() {
+		line := 1
+		if len(result.Regions) > 0 {
+			line = result.Regions[0].Line
+		}
+
+		message := strings.TrimSpace(result.Message)
+		// The fingerprint identifies the issue across pipelines, so that
+		// GitLab can tell new issues from resolved ones.
+		fingerprint := sha256.Sum256([]byte(strings.Join([]string{result.RuleID, result.File, message}, "\x00")))
+
+		issues = append(issues, codeQualityIssue{
+			Description: message,
+			CheckName:   result.RuleID,
+			Fingerprint: hex.EncodeToString(fingerprint[:]),
+			Severity:    codeQualitySeverity(result.Evaluation),
+			Location: codeQualityLocation{
+				Path:  result.File,
+				Lines: codeQualityLines{Begin: line},
+			},
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(issues)
+}
+
+// codeQualitySeverity returns the Code Quality severity of issues of the given
+// SARIF level.
+func codeQualitySeverity(level string) string {
+	switch rules.Severity(level) {
+	case rules.SeverityError:
+		return "major"
+	case rules.SeverityWarning:
+		return "minor"
+	default:
+		return "info"
+	}
+}
@@ -0,0 +1,45 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/Bonial-International-GmbH/sops-check/internal/rules"
+	"github.com/Bonial-International-GmbH/sops-check/internal/sops"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCodeQuality(t *testing.T) {
+	var report Report
+
+	report.Add(File{Path: "a.yaml", Status: StatusFail, SarifResults: []rules.SarifResult{
+		{RuleID: "team-key", Evaluation: "error", Message: "missing\n", File: "a.yaml", Regions: []sops.Region{{Line: 3, Column: 5}}},
+		{RuleID: "age", Evaluation: "warning", Message: "too old", File: "a.yaml"},
+	}})
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteCodeQuality(&buf))
+
+	var issues []codeQualityIssue
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &issues))
+	require.Len(t, issues, 2)
+
+	assert.Equal(t, "missing", issues[0].Description)
+	assert.Equal(t, "team-key", issues[0].CheckName)
+	assert.Equal(t, "major", issues[0].Severity)
+	assert.Equal(t, codeQualityLocation{Path: "a.yaml", Lines: codeQualityLines{Begin: 3}}, issues[0].Location)
+	assert.Len(t, issues[0].Fingerprint, 64)
+
+	assert.Equal(t, "minor", issues[1].Severity)
+	assert.Equal(t, 1, issues[1].Location.Lines.Begin)
+	assert.NotEqual(t, issues[0].Fingerprint, issues[1].Fingerprint)
+}
+
+func TestWriteCodeQualityEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, (&Report{}).WriteCodeQuality(&buf))
+
+	assert.Equal(t, "[]\n", buf.String())
+}
@@ -0,0 +1,55 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Bonial-International-GmbH/sops-check/internal/rules"
+)
+
+// githubDataEscaper escapes the message of a GitHub Actions workflow command.
+var githubDataEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+// githubPropertyEscaper escapes the property values of a GitHub Actions
+// workflow command.
+var githubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+
+// WriteGitHub writes the SARIF results of the report as GitHub Actions
+// workflow commands to w, which GitHub shows as annotations on the affected
+// files. Results point at their first region, if any.
+func (r *Report) WriteGitHub(w io.Writer) error {
+	for _, result := range r.SarifResults() {
+		properties := []string{"file=" + githubPropertyEscaper.Replace(result.File)}
+
+		if len(result.Regions) > 0 {
+			region := result.Regions[0]
+			properties = append(properties, fmt.Sprintf("line=%d", region.Line), fmt.Sprintf("col=%d", region.Column))
+		}
+
+		properties = append(properties, "title="+githubPropertyEscaper.Replace(result.RuleID))
+
+		_, err := fmt.Fprintf(w, "::%s %s::%s\n",
+			githubCommand(result.Evaluation),
+			strings.Join(properties, ","),
+			githubDataEscaper.Replace(strings.TrimSpace(result.Message)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// githubCommand returns the workflow command for annotations of the given
+// SARIF level.
+func githubCommand(level string) string {
+	switch rules.Severity(level) {
+	case rules.SeverityError:
+		return "error"
+	case rules.SeverityWarning:
+		return "warning"
+	default:
+		return "notice"
+	}
+}
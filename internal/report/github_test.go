@@ -0,0 +1,32 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Bonial-International-GmbH/sops-check/internal/rules"
+	"github.com/Bonial-International-GmbH/sops-check/internal/sops"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteGitHub(t *testing.T) {
+	var report Report
+
+	report.Add(File{Path: "a,b.yaml", Status: StatusFail, SarifResults: []rules.SarifResult{
+		{RuleID: "team-key", Evaluation: "error", Message: "first: 100%\nsecond\n", File: "a,b.yaml", Regions: []sops.Region{{Line: 3, Column: 5}, {Line: 9, Column: 5}}},
+		{RuleID: "age", Evaluation: "warning", Message: "too old", File: "a,b.yaml"},
+	}})
+	report.Add(File{Path: "c.yaml", Status: StatusPass})
+	report.Add(File{Path: "d.yaml", Status: StatusWarning, SarifResults: []rules.SarifResult{
+		{RuleID: "hint", Evaluation: "note", Message: "consider", File: "d.yaml"},
+	}})
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteGitHub(&buf))
+
+	assert.Equal(t, ""+
+		"::error file=a%2Cb.yaml,line=3,col=5,title=team-key::first: 100%25%0Asecond\n"+
+		"::warning file=a%2Cb.yaml,title=age::too old\n"+
+		"::notice file=d.yaml,title=hint::consider\n", buf.String())
+}
@@ -0,0 +1,123 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes the report as JUnit XML to w. Every file is a test case,
+// and test cases are grouped into test suites by directory. Failures carry the
+// human readable description of the issues. As JUnit has no notion of
+// warnings, files with warnings pass and contain the description of the
+// warnings as output. Files to which no rule applies are skipped.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	root := junitTestSuites{Name: "sops-check"}
+	suites := make(map[string]*junitTestSuite)
+
+	for _, file := range r.Files {
+		dir := filepath.ToSlash(filepath.Dir(file.Path))
+
+		suite, ok := suites[dir]
+		if !ok {
+			suite = &junitTestSuite{Name: dir}
+			suites[dir] = suite
+		}
+
+		testCase := junitTestCase{Name: file.Name(), ClassName: dir}
+
+		switch {
+		case file.Status == StatusFail:
+			text := file.Text()
+			testCase.Failure = &junitFailure{Message: firstLine(text), Type: "error", Text: text}
+			suite.Failures++
+		case file.Status == StatusWarning:
+			testCase.SystemOut = file.Text()
+		case file.Result != nil && file.Result.NotApplicable:
+			testCase.Skipped = &junitSkipped{Message: "No rules apply to this file."}
+			suite.Skipped++
+		}
+
+		suite.Tests++
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	dirs := make([]string, 0, len(suites))
+	for dir := range suites {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		suite := suites[dir]
+
+		root.Tests += suite.Tests
+		root.Failures += suite.Failures
+		root.Skipped += suite.Skipped
+		root.Suites = append(root.Suites, *suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintln(w)
+
+	return err
+}
+
+// firstLine returns the first non-empty line of text.
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+
+	return ""
+}
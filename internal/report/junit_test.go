@@ -0,0 +1,60 @@
+package report
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/Bonial-International-GmbH/sops-check/internal/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	var report Report
+
+	ctx := rules.NewEvalContext([]string{"age1first"})
+	pass := rules.Match("age1first").Eval(ctx)
+	fail := rules.Match("age1second").Eval(ctx)
+	notApplicable := rules.EvalResult{Success: true, NotApplicable: true}
+
+	report.Add(File{Path: "envs/prod/secret.yaml", Status: StatusFail, Result: &fail})
+	report.Add(File{Path: "envs/dev/secret.yaml", Status: StatusPass, Result: &pass})
+	report.Add(File{Path: "envs/dev/other.yaml", Status: StatusWarning, Issues: []string{"File is malformed"}})
+	report.Add(File{Path: "envs/prod/skipped.yaml", Status: StatusPass, Result: &notApplicable})
+	report.Add(File{Path: "secret.yaml", Commit: "abc123", Status: StatusPass, Result: &pass})
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteJUnit(&buf))
+	require.True(t, strings.HasPrefix(buf.String(), xml.Header))
+
+	var decoded junitTestSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &decoded))
+
+	assert.Equal(t, 5, decoded.Tests)
+	assert.Equal(t, 1, decoded.Failures)
+	assert.Equal(t, 1, decoded.Skipped)
+
+	require.Len(t, decoded.Suites, 3)
+	assert.Equal(t, ".", decoded.Suites[0].Name)
+	assert.Equal(t, "envs/dev", decoded.Suites[1].Name)
+	assert.Equal(t, "envs/prod", decoded.Suites[2].Name)
+
+	assert.Equal(t, "secret.yaml (commit abc123)", decoded.Suites[0].TestCases[0].Name)
+	assert.Nil(t, decoded.Suites[0].TestCases[0].Failure)
+
+	dev := decoded.Suites[1]
+	assert.Equal(t, 2, dev.Tests)
+	assert.Equal(t, 0, dev.Failures)
+	assert.Equal(t, "File is malformed", dev.TestCases[1].SystemOut)
+
+	prod := decoded.Suites[2]
+	assert.Equal(t, 2, prod.Tests)
+	assert.Equal(t, 1, prod.Failures)
+	assert.Equal(t, 1, prod.Skipped)
+	require.NotNil(t, prod.TestCases[0].Failure)
+	assert.Equal(t, fail.Format(), prod.TestCases[0].Failure.Text)
+	assert.Equal(t, firstLine(fail.Format()), prod.TestCases[0].Failure.Message)
+	require.NotNil(t, prod.TestCases[1].Skipped)
+}
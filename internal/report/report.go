@@ -0,0 +1,140 @@
+// Package report collects the outcome of a check for machine-readable
+// reports.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Bonial-International-GmbH/sops-check/internal/rules"
+)
+
+// Status is the outcome of checking a single file.
+type Status string
+
+const (
+	// StatusPass indicates that no issues were found.
+	StatusPass Status = "pass"
+	// StatusWarning indicates that only issues which do not fail the check
+	// were found.
+	StatusWarning Status = "warning"
+	// StatusFail indicates that issues which fail the check were found.
+	StatusFail Status = "fail"
+)
+
+// File is the outcome of checking a single file, a version of a file in the
+// git history or a creation rule in a .sops.yaml file.
+type File struct {
+	// Path is the path of the file.
+	Path string `json:"path"`
+	// Commit is the commit which introduced the checked version of the file.
+	// It is only set when checking the git history.
+	Commit string `json:"commit,omitempty"`
+	// CreationRule describes the checked creation rule if Path is a
+	// .sops.yaml file.
+	CreationRule string `json:"creationRule,omitempty"`
+	Status       Status `json:"status"`
+	// Result is the result of evaluating the rules. It is nil if the rules
+	// were not evaluated, e.g. for malformed files.
+	Result *rules.EvalResult `json:"result,omitempty"`
+	// Issues contains human readable descriptions of issues found by checks
+	// other than the rules, e.g. drift from creation rules.
+	Issues []string `json:"issues,omitempty"`
+	// SarifResults contains the issues found in the file as SARIF results.
+	SarifResults []rules.SarifResult `json:"-"`
+}
+
+// Name returns the name of the file as shown to the user, which identifies
+// the commit or creation rule as well, if any.
+func (f *File) Name() string {
+	switch {
+	case f.Commit != "":
+		return fmt.Sprintf("%s (commit %s)", f.Path, f.Commit)
+	case f.CreationRule != "":
+		return fmt.Sprintf("%s %s", f.Path, f.CreationRule)
+	default:
+		return f.Path
+	}
+}
+
+// Text returns the human readable description of the issues found in the
+// file.
+func (f *File) Text() string {
+	var parts []string
+
+	if f.Result != nil {
+		if text := f.Result.Format(); text != "" {
+			parts = append(parts, text)
+		}
+	}
+
+	parts = append(parts, f.Issues...)
+
+	return strings.Join(parts, "\n")
+}
+
+// Summary contains the number of checked files by status.
+type Summary struct {
+	Files    int `json:"files"`
+	Passed   int `json:"passed"`
+	Warnings int `json:"warnings"`
+	Failed   int `json:"failed"`
+}
+
+// Report collects the outcome of checking all files.
+type Report struct {
+	Files []File
+}
+
+// Add adds the outcome of checking a file to the report.
+func (r *Report) Add(file File) {
+	r.Files = append(r.Files, file)
+}
+
+// Summary counts the files in the report by status.
+func (r *Report) Summary() Summary {
+	summary := Summary{Files: len(r.Files)}
+
+	for _, file := range r.Files {
+		switch file.Status {
+		case StatusPass:
+			summary.Passed++
+		case StatusWarning:
+			summary.Warnings++
+		case StatusFail:
+			summary.Failed++
+		}
+	}
+
+	return summary
+}
+
+// SarifResults returns the SARIF results of all files.
+func (r *Report) SarifResults() []rules.SarifResult {
+	var results []rules.SarifResult
+
+	for _, file := range r.Files {
+		results = append(results, file.SarifResults...)
+	}
+
+	return results
+}
+
+// WriteJSON writes the report as indented JSON to w. It contains the full
+// evaluation result of every file along with a summary.
+func (r *Report) WriteJSON(w io.Writer) error {
+	files := r.Files
+	if files == nil {
+		files = []File{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(struct {
+		Files   []File  `json:"files"`
+		Summary Summary `json:"summary"`
+	}{files, r.Summary()})
+}
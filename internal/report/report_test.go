@@ -0,0 +1,64 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/Bonial-International-GmbH/sops-check/internal/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport(t *testing.T) {
+	var report Report
+
+	result := rules.Match("age1first").Eval(rules.NewEvalContext([]string{"age1first", "age1second"}))
+
+	report.Add(File{Path: "pass.yaml", Status: StatusPass, Result: &result})
+	report.Add(File{Path: "warning.yaml", Status: StatusWarning, Issues: []string{"malformed"}})
+	report.Add(File{
+		Path:         "fail.yaml",
+		Status:       StatusFail,
+		SarifResults: []rules.SarifResult{{RuleID: "a"}, {RuleID: "b"}},
+	})
+	report.Add(File{
+		Path:         ".sops.yaml",
+		CreationRule: "creation rule #1",
+		Status:       StatusFail,
+		SarifResults: []rules.SarifResult{{RuleID: "c"}},
+	})
+
+	assert.Equal(t, Summary{Files: 4, Passed: 1, Warnings: 1, Failed: 2}, report.Summary())
+	assert.Len(t, report.SarifResults(), 3)
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteJSON(&buf))
+
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+
+	files := decoded["files"].([]any)
+	require.Len(t, files, 4)
+
+	assert.Equal(t, map[string]any{
+		"path":   "pass.yaml",
+		"status": "pass",
+		"result": map[string]any{
+			"rule":      map[string]any{"kind": "match", "trustAnchor": "age1first"},
+			"success":   true,
+			"matched":   []any{"age1first"},
+			"unmatched": []any{"age1second"},
+		},
+	}, files[0])
+	assert.Equal(t, map[string]any{"path": "warning.yaml", "status": "warning", "issues": []any{"malformed"}}, files[1])
+	assert.Equal(t, "creation rule #1", files[3].(map[string]any)["creationRule"])
+	assert.Equal(t, map[string]any{"files": 4.0, "passed": 1.0, "warnings": 1.0, "failed": 2.0}, decoded["summary"])
+}
+
+func TestEmptyReport(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, (&Report{}).WriteJSON(&buf))
+
+	assert.JSONEq(t, `{"files": [], "summary": {"files": 0, "passed": 0, "warnings": 0, "failed": 0}}`, buf.String())
+}
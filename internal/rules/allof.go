@@ -16,15 +16,26 @@ func (*AllOfRule) Kind() Kind {
 	return KindAllOf
 }
 
+// MarshalJSON implements json.Marshaler.
+func (r *AllOfRule) MarshalJSON() ([]byte, error) {
+	return marshalRule(r, ruleJSON{})
+}
+
 // Eval implements Rule.
 func (r *AllOfRule) Eval(ctx *EvalContext) EvalResult {
 	result := evalRules(ctx, r.rules)
+	if result.notApplicable() {
+		return notApplicable(ctx, r)
+	}
+
+	success, warnings := result.check(result.applicableCount, result.applicableCount)
 
 	return EvalResult{
 		Rule:      r,
-		Success:   result.successCount == len(r.rules),
+		Success:   success,
 		Matched:   result.matched,
 		Unmatched: ctx.TrustAnchors.Difference(result.matched),
 		Nested:    result.results,
+		Warnings:  warnings,
 	}
 }
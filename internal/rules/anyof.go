@@ -16,15 +16,26 @@ func (*AnyOfRule) Kind() Kind {
 	return KindAnyOf
 }
 
+// MarshalJSON implements json.Marshaler.
+func (r *AnyOfRule) MarshalJSON() ([]byte, error) {
+	return marshalRule(r, ruleJSON{})
+}
+
 // Eval implements Rule.
 func (r *AnyOfRule) Eval(ctx *EvalContext) EvalResult {
 	result := evalRules(ctx, r.rules)
+	if result.notApplicable() {
+		return notApplicable(ctx, r)
+	}
+
+	success, warnings := result.check(1, len(r.rules))
 
 	return EvalResult{
 		Rule:      r,
-		Success:   result.successCount > 0,
+		Success:   success,
 		Matched:   result.matched,
 		Unmatched: ctx.TrustAnchors.Difference(result.matched),
 		Nested:    result.results,
+		Warnings:  warnings,
 	}
 }
@@ -3,14 +3,39 @@ package rules
 import (
 	"fmt"
 	"regexp"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/Bonial-International-GmbH/sops-check/internal/config"
+	"github.com/Bonial-International-GmbH/sops-check/internal/sops"
 )
 
-// Compile takes a slice of rule configurations and compiles it into a single
-// rule that can be evaluated.
-func Compile(rules []config.Rule) (root Rule, err error) {
-	compiled, err := compileRules(rules)
+// Compile takes a configuration and compiles its rules into a single rule that
+// can be evaluated. References to rule definitions are resolved during
+// compilation.
+func Compile(cfg *config.Config) (root Rule, err error) {
+	c := &compiler{
+		definitions: cfg.Definitions,
+		compiled:    make(map[string]Rule),
+		ids:         make(map[string]bool),
+	}
+
+	// Compile all definitions upfront, so that invalid definitions are
+	// detected even if they are not referenced by any rule.
+	names := make([]string, 0, len(cfg.Definitions))
+	for name := range cfg.Definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := c.compileDefinition(name); err != nil {
+			return nil, err
+		}
+	}
+
+	compiled, err := c.compileRules("rules", cfg.Rules)
 	if err != nil {
 		return nil, err
 	}
@@ -18,11 +43,27 @@ func Compile(rules []config.Rule) (root Rule, err error) {
 	return AllOf(compiled...), nil
 }
 
-func compileRules(rules []config.Rule) ([]Rule, error) {
+// compiler holds the state needed to resolve references to rule definitions.
+type compiler struct {
+	// definitions contains the configuration of all named rule definitions.
+	definitions map[string]config.Rule
+	// compiled caches definitions that were already compiled.
+	compiled map[string]Rule
+	// ids contains the IDs of all compiled rules. It is used to detect
+	// duplicate IDs.
+	ids map[string]bool
+	// stack contains the names of all definitions that are currently being
+	// compiled. It is used to detect cyclic references.
+	stack []string
+}
+
+// compileRules compiles the list of rules found at path within the
+// configuration.
+func (c *compiler) compileRules(path string, rules []config.Rule) ([]Rule, error) {
 	compiled := make([]Rule, len(rules))
 
 	for i, rule := range rules {
-		compiledRule, err := compileRule(rule)
+		compiledRule, err := c.compileRule(fmt.Sprintf("%s[%d]", path, i), rule)
 		if err != nil {
 			return nil, err
 		}
@@ -33,21 +74,37 @@ func compileRules(rules []config.Rule) ([]Rule, error) {
 	return compiled, nil
 }
 
-func compileRule(config config.Rule) (Rule, error) {
-	compiled, err := compileRuleInner(config)
+// compileRule compiles the rule found at path within the configuration. The
+// path is used as the ID of the rule, unless it has an explicit ID.
+func (c *compiler) compileRule(path string, config config.Rule) (Rule, error) {
+	id := config.ID
+	if id == "" {
+		id = path
+	}
+
+	if c.ids[id] {
+		return nil, fmt.Errorf("duplicate rule id %q", id)
+	}
+
+	c.ids[id] = true
+
+	compiled, err := c.compileRuleInner(path, config)
 	if err != nil {
 		return nil, err
 	}
 
 	compiled.SetMeta(Meta{
+		ID:          id,
 		Description: config.Description,
 		URL:         config.URL,
+		Scope:       NewScope(config.Paths, config.ExcludePaths),
+		Severity:    Severity(config.Severity),
 	})
 
 	return compiled, nil
 }
 
-func compileRuleInner(rule config.Rule) (Rule, error) {
+func (c *compiler) compileRuleInner(path string, rule config.Rule) (Rule, error) {
 	if rule.Match != "" {
 		return Match(rule.Match), nil
 	}
@@ -61,8 +118,38 @@ func compileRuleInner(rule config.Rule) (Rule, error) {
 		return MatchRegex(pattern), nil
 	}
 
+	if rule.MatchType != "" {
+		return MatchType(sops.KeyType(rule.MatchType)), nil
+	}
+
+	if rule.MatchKMS != nil {
+		return MatchKMS(rule.MatchKMS.Patterns())
+	}
+
+	if rule.MaxKeyAge != "" {
+		maxAge, err := config.ParseDuration(rule.MaxKeyAge)
+		if err != nil {
+			return nil, err
+		}
+
+		return MaxKeyAge(maxAge), nil
+	}
+
+	if rule.MaxLastModifiedAge != "" {
+		maxAge, err := config.ParseDuration(rule.MaxLastModifiedAge)
+		if err != nil {
+			return nil, err
+		}
+
+		return MaxLastModifiedAge(maxAge), nil
+	}
+
+	if rule.Metadata != nil {
+		return compileMetadata(rule.Metadata)
+	}
+
 	if rule.Not != nil {
-		inner, err := compileRule(*rule.Not)
+		inner, err := c.compileRule(path+".not", *rule.Not)
 		if err != nil {
 			return nil, err
 		}
@@ -71,7 +158,7 @@ func compileRuleInner(rule config.Rule) (Rule, error) {
 	}
 
 	if len(rule.AllOf) > 0 {
-		rules, err := compileRules(rule.AllOf)
+		rules, err := c.compileRules(path+".allOf", rule.AllOf)
 		if err != nil {
 			return nil, err
 		}
@@ -80,7 +167,7 @@ func compileRuleInner(rule config.Rule) (Rule, error) {
 	}
 
 	if len(rule.AnyOf) > 0 {
-		rules, err := compileRules(rule.AnyOf)
+		rules, err := c.compileRules(path+".anyOf", rule.AnyOf)
 		if err != nil {
 			return nil, err
 		}
@@ -89,7 +176,7 @@ func compileRuleInner(rule config.Rule) (Rule, error) {
 	}
 
 	if len(rule.OneOf) > 0 {
-		rules, err := compileRules(rule.OneOf)
+		rules, err := c.compileRules(path+".oneOf", rule.OneOf)
 		if err != nil {
 			return nil, err
 		}
@@ -97,5 +184,156 @@ func compileRuleInner(rule config.Rule) (Rule, error) {
 		return OneOf(rules...), nil
 	}
 
+	if len(rule.Rules) > 0 {
+		rules, err := c.compileRules(path+".rules", rule.Rules)
+		if err != nil {
+			return nil, err
+		}
+
+		return compileNOf(rule, rules), nil
+	}
+
+	if rule.KeyGroups != nil {
+		return KeyGroups(compileRange(rule.KeyGroups)), nil
+	}
+
+	if rule.ShamirThreshold != nil {
+		return ShamirThreshold(compileRange(rule.ShamirThreshold)), nil
+	}
+
+	if rule.InEveryKeyGroup != nil {
+		inner, err := c.compileRule(path+".inEveryKeyGroup", *rule.InEveryKeyGroup)
+		if err != nil {
+			return nil, err
+		}
+
+		return InEveryKeyGroup(inner), nil
+	}
+
+	if rule.InAnyKeyGroup != nil {
+		inner, err := c.compileRule(path+".inAnyKeyGroup", *rule.InAnyKeyGroup)
+		if err != nil {
+			return nil, err
+		}
+
+		return InAnyKeyGroup(inner), nil
+	}
+
+	if rule.Ref != "" {
+		inner, err := c.compileDefinition(rule.Ref)
+		if err != nil {
+			return nil, err
+		}
+
+		return Ref(rule.Ref, inner), nil
+	}
+
 	return nil, fmt.Errorf("rule %v has no conditions", rule)
 }
+
+// compileDefinition compiles the rule definition with the given name. Returns
+// an error if the definition does not exist or references itself, either
+// directly or indirectly.
+func (c *compiler) compileDefinition(name string) (Rule, error) {
+	if compiled, ok := c.compiled[name]; ok {
+		return compiled, nil
+	}
+
+	definition, ok := c.definitions[name]
+	if !ok {
+		return nil, fmt.Errorf("reference to unknown rule definition %q", name)
+	}
+
+	if slices.Contains(c.stack, name) {
+		cycle := append(slices.Clone(c.stack), name)
+		return nil, fmt.Errorf("cyclic reference to rule definition: %s", strings.Join(cycle, " -> "))
+	}
+
+	c.stack = append(c.stack, name)
+	defer func() { c.stack = c.stack[:len(c.stack)-1] }()
+
+	compiled, err := c.compileRule("definitions."+name, definition)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule definition %q: %w", name, err)
+	}
+
+	c.compiled[name] = compiled
+
+	return compiled, nil
+}
+
+// compileNOf creates an NOfRule from the atLeast, atMost and exactly fields of
+// the rule configuration.
+func compileNOf(rule config.Rule, rules []Rule) Rule {
+	if rule.Exactly != nil {
+		return Exactly(*rule.Exactly, rules...)
+	}
+
+	atLeast, atMost := 0, len(rules)
+
+	if rule.AtLeast != nil {
+		atLeast = *rule.AtLeast
+	}
+
+	if rule.AtMost != nil {
+		atMost = *rule.AtMost
+	}
+
+	return NOf(atLeast, atMost, rules...)
+}
+
+// compileRange converts a range from the configuration into min and max
+// bounds. A missing max is converted into a negative value.
+func compileRange(r *config.Range) (min, max int) {
+	min, max = 0, -1
+
+	if r.Min != nil {
+		min = *r.Min
+	}
+
+	if r.Max != nil {
+		max = *r.Max
+	}
+
+	return min, max
+}
+
+// compileMetadata creates a MetadataRule from the metadata requirements of the
+// rule configuration.
+func compileMetadata(metadata *config.Metadata) (Rule, error) {
+	var checks []MetadataCheck
+
+	presence := metadata.Presence()
+	fields := make([]string, 0, len(presence))
+	for field := range presence {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		if presence[field] == config.PresenceRequired {
+			checks = append(checks, RequireField(MetadataField(field)))
+		} else {
+			checks = append(checks, ForbidField(MetadataField(field)))
+		}
+	}
+
+	if metadata.MACOnlyEncrypted != nil {
+		checks = append(checks, RequireMACOnlyEncrypted(*metadata.MACOnlyEncrypted))
+	}
+
+	if metadata.MinVersion != "" {
+		check, err := MinVersion(metadata.MinVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		checks = append(checks, check)
+	}
+
+	if len(metadata.EncryptedKeys) > 0 {
+		checks = append(checks, RequireEncryptedKeys(metadata.EncryptedKeys...))
+	}
+
+	return Metadata(checks...), nil
+}
@@ -1,17 +1,124 @@
 package rules
 
-import "github.com/hashicorp/go-set/v3"
+import (
+	"time"
+
+	"github.com/Bonial-International-GmbH/sops-check/internal/sops"
+	gosops "github.com/getsops/sops/v3"
+	"github.com/hashicorp/go-set/v3"
+)
 
 // EvalContext encapsulates data needed during rule evaluation, like the trust
 // anchors found within a given SOPS file.
 type EvalContext struct {
 	// TrustAnchors is a set of trust anchors found in a SOPS file.
 	TrustAnchors set.Collection[string]
+	// TrustAnchorDetails maps the identifiers in TrustAnchors to their
+	// structured representation, which allows type-aware matching.
+	TrustAnchorDetails map[string]sops.TrustAnchor
+	// KeyGroups contains the identifiers of the trust anchors in each key
+	// group of a SOPS file.
+	KeyGroups [][]string
+	// FilePath is the path of the SOPS file. It is used to decide whether
+	// rules with a path scope apply. If empty, the path is unknown, e.g. when
+	// linting creation rules, and rules with a path scope do not apply.
+	FilePath string
+	// Metadata contains the SOPS metadata of the file, e.g. its encryption
+	// settings and the SOPS version it was encrypted with. Rules treat nil
+	// metadata as if all fields were empty.
+	Metadata *gosops.Metadata
+	// UnknownVersion is true if the SOPS version in Metadata is unknown
+	// because nothing has been encrypted yet, e.g. when linting creation
+	// rules. Requirements on the version are skipped then.
+	UnknownVersion bool
+	// Now is the point in time used to evaluate age-based rules. If zero, the
+	// current time is used.
+	Now time.Time
 }
 
-// NewEvalContext creates a new EvalContext from a list of trust anchors.
+// NewEvalContext creates a new EvalContext from a list of trust anchors. The
+// types of the trust anchors are inferred from their format.
 func NewEvalContext(trustAnchors []string) *EvalContext {
-	return &EvalContext{TrustAnchors: set.From(trustAnchors)}
+	anchors := make([]sops.TrustAnchor, len(trustAnchors))
+
+	for i, trustAnchor := range trustAnchors {
+		anchors[i] = sops.ParseTrustAnchor(trustAnchor)
+	}
+
+	return NewEvalContextFromTrustAnchors(anchors)
+}
+
+// NewEvalContextFromTrustAnchors creates a new EvalContext from a list of
+// structured trust anchors, which are all considered to be part of a single
+// key group.
+func NewEvalContextFromTrustAnchors(trustAnchors []sops.TrustAnchor) *EvalContext {
+	if len(trustAnchors) == 0 {
+		return NewEvalContextFromKeyGroups(nil)
+	}
+
+	return NewEvalContextFromKeyGroups([][]sops.TrustAnchor{trustAnchors})
+}
+
+// NewEvalContextFromKeyGroups creates a new EvalContext from the structured
+// trust anchors of each key group.
+func NewEvalContextFromKeyGroups(keyGroups [][]sops.TrustAnchor) *EvalContext {
+	ids := emptyStringSet()
+	details := make(map[string]sops.TrustAnchor)
+	groups := make([][]string, len(keyGroups))
+
+	for i, keyGroup := range keyGroups {
+		groups[i] = make([]string, len(keyGroup))
+
+		for j, anchor := range keyGroup {
+			ids.Insert(anchor.ID)
+			details[anchor.ID] = anchor
+			groups[i][j] = anchor.ID
+		}
+	}
+
+	return &EvalContext{
+		TrustAnchors:       ids,
+		TrustAnchorDetails: details,
+		KeyGroups:          groups,
+	}
+}
+
+// keyGroup returns a copy of ctx which only contains the trust anchors of the
+// key group at index i.
+func (ctx *EvalContext) keyGroup(i int) *EvalContext {
+	groupCtx := *ctx
+	groupCtx.TrustAnchors = set.From(ctx.KeyGroups[i])
+	groupCtx.KeyGroups = ctx.KeyGroups[i : i+1]
+	return &groupCtx
+}
+
+// now returns the point in time used to evaluate age-based rules.
+func (ctx *EvalContext) now() time.Time {
+	if ctx.Now.IsZero() {
+		return time.Now()
+	}
+
+	return ctx.Now
+}
+
+// shamirThreshold returns the number of key groups required to decrypt the
+// file. SOPS requires all key groups if no threshold is set.
+func (ctx *EvalContext) shamirThreshold() int {
+	if ctx.Metadata != nil && ctx.Metadata.ShamirThreshold > 0 {
+		return ctx.Metadata.ShamirThreshold
+	}
+
+	return len(ctx.KeyGroups)
+}
+
+// trustAnchor returns the structured representation of a trust anchor. If
+// there are no details available, they are inferred from the identifier.
+func (ctx *EvalContext) trustAnchor(id string) sops.TrustAnchor {
+	if anchor, ok := ctx.TrustAnchorDetails[id]; ok {
+		return anchor
+	}
+
+	return sops.ParseTrustAnchor(id)
 }
 
 // EvalResult represents the result of a rule evaluation.
@@ -20,6 +127,10 @@ type EvalResult struct {
 	Rule Rule
 	// Success indicates whether the rule was matched by the input or not.
 	Success bool
+	// NotApplicable indicates that the rule was not evaluated because the
+	// file is outside of the rule's path scope. Results that are not
+	// applicable are always successful, but are ignored by compound rules.
+	NotApplicable bool
 	// Matched contains trust anchors that were matched during rule evaluation,
 	// if any. This may even contain trust anchors if rule evaluation failed,
 	// indicating partial matches.
@@ -30,28 +141,51 @@ type EvalResult struct {
 	// in order to produce the result. This allows identifying the exact nested
 	// rules that led to evaluation success (or failure).
 	Nested []EvalResult
+	// Violations contains human readable descriptions of the requirements
+	// that were violated by rules which do not match trust anchors, e.g.
+	// metadata rules.
+	Violations []string
+	// Warnings contains soft failures of nested rules with a severity other
+	// than SeverityError which were tolerated in order to produce a
+	// successful result.
+	Warnings []EvalResult
+}
+
+// softFailure returns true if the result is a failure of a rule with a
+// severity that should not fail the check.
+func (r *EvalResult) softFailure() bool {
+	return !r.Success && r.Rule.Meta().Severity.soft()
 }
 
-// SarifResult converts the evaluation results to SARIF format.
-func (r *EvalResult) SarifResult(filepath string, allowUnmatched bool) SarifResult {
-	success := r.Success
-	if r.Success && r.Unmatched.Size() > 0 && !allowUnmatched {
-		success = false
+// Severity returns the severity of the result. This is SeverityError if the
+// evaluation failed, the highest severity of any warnings if it succeeded with
+// warnings, and an empty Severity otherwise.
+func (r *EvalResult) Severity() Severity {
+	if !r.Success {
+		return SeverityError
 	}
-	sarifResult := SarifResult{
-		RuleID:      string(r.Rule.Kind()),
-		Evaluation:  map[bool]string{true: "none", false: "error"}[success],
-		Kind:        map[bool]string{true: "pass", false: "fail"}[success],
-		Message:     r.Format(),
-		Description: r.Rule.Meta().Description,
-		File:        filepath,
+
+	var severity Severity
+
+	for _, warning := range r.Warnings {
+		switch warning.Rule.Meta().Severity {
+		case SeverityWarning:
+			return SeverityWarning
+		case SeverityNote:
+			severity = SeverityNote
+		}
 	}
-	return sarifResult
+
+	return severity
 }
 
 // partitionNested partitions nested results into success and failure.
 func (r *EvalResult) partitionNested() (successes, failures []EvalResult) {
 	for _, result := range r.Nested {
+		if result.NotApplicable {
+			continue
+		}
+
 		if result.Success {
 			successes = append(successes, result)
 		} else {
@@ -86,8 +220,17 @@ func (r *EvalResult) Format() string {
 		formatFailure(&buf, result)
 	}
 
+	if len(result.Warnings) > 0 {
+		if buf.Len() > 0 {
+			buf.WriteRune('\n')
+		}
+
+		buf.WriteString("Warnings:\n")
+		buf.writeIndentedList(result.Warnings, formatFailure)
+	}
+
 	if !result.Unmatched.Empty() {
-		if !result.Success {
+		if buf.Len() > 0 {
 			// Leave some space between the failure output and the unmatched
 			// trust anchors.
 			buf.WriteRune('\n')
@@ -100,32 +243,145 @@ func (r *EvalResult) Format() string {
 	return buf.String()
 }
 
+// evalRule evaluates a single rule if the file in ctx is within the rule's path
+// scope. Otherwise, a result that is marked as not applicable is returned.
+func evalRule(ctx *EvalContext, rule Rule) EvalResult {
+	scope := rule.Meta().Scope
+
+	if scope != nil && ctx.FilePath == "" {
+		// The rule may apply to some of the files with an unknown path,
+		// so the trust anchors it matches are not reported as unmatched.
+		result := notApplicable(ctx, rule)
+
+		if evaluated := rule.Eval(ctx); evaluated.Success {
+			result.Matched = evaluated.Matched
+			result.Unmatched = evaluated.Unmatched
+		}
+
+		return result
+	}
+
+	if !scope.Matches(ctx.FilePath) {
+		return notApplicable(ctx, rule)
+	}
+
+	return rule.Eval(ctx)
+}
+
+// notApplicable creates a result for a rule that does not apply to the file in
+// ctx.
+func notApplicable(ctx *EvalContext, rule Rule) EvalResult {
+	matched := emptyStringSet()
+
+	return EvalResult{
+		Rule:          rule,
+		Success:       true,
+		NotApplicable: true,
+		Matched:       matched,
+		Unmatched:     ctx.TrustAnchors.Difference(matched),
+	}
+}
+
 // evalRulesResult is a helper type returned by evalRules.
 type evalRulesResult struct {
-	results      []EvalResult
-	matched      set.Collection[string]
-	successCount int
+	results          []EvalResult
+	matched          set.Collection[string]
+	successCount     int
+	softFailureCount int
+	applicableCount  int
+}
+
+// notApplicable returns true if none of the evaluated rules was applicable.
+func (r *evalRulesResult) notApplicable() bool {
+	return len(r.results) > 0 && r.applicableCount == 0
+}
+
+// check returns true if the number of successful rules lies between atLeast
+// and atMost. Soft failures may be counted as either success or failure to
+// satisfy this condition.
+//
+// If the condition cannot be satisfied without tolerating soft failures or
+// nested warnings, the returned warnings contain all soft failures along with
+// the warnings of successful rules.
+func (r *evalRulesResult) check(atLeast, atMost int) (success bool, warnings []EvalResult) {
+	if r.successCount > atMost || r.successCount+r.softFailureCount < atLeast {
+		return false, nil
+	}
+
+	strictSuccessCount := 0
+
+	for _, result := range r.results {
+		if !result.NotApplicable && result.Success && len(result.Warnings) == 0 {
+			strictSuccessCount++
+		}
+	}
+
+	if strictSuccessCount >= atLeast {
+		return true, nil
+	}
+
+	for _, result := range r.results {
+		if result.Success {
+			warnings = append(warnings, result.Warnings...)
+		} else if result.softFailure() {
+			warnings = append(warnings, result)
+		}
+	}
+
+	return true, warnings
 }
 
 // evalRules evaluates a slice of rules and collects the results along with the
-// number of successes and a set of matched trust anchors.
+// number of successes and a set of matched trust anchors. Rules that are not
+// applicable are neither counted as success nor as failure.
 func evalRules(ctx *EvalContext, rules []Rule) evalRulesResult {
+	return collectResults(len(rules), func(i int) EvalResult {
+		return evalRule(ctx, rules[i])
+	})
+}
+
+// evalKeyGroups evaluates a rule against the trust anchors of each key group
+// individually and collects the results like evalRules.
+func evalKeyGroups(ctx *EvalContext, rule Rule) evalRulesResult {
+	return collectResults(len(ctx.KeyGroups), func(i int) EvalResult {
+		return evalRule(ctx.keyGroup(i), rule)
+	})
+}
+
+// collectResults invokes eval n times and collects the results along with the
+// number of successes and a set of matched trust anchors.
+func collectResults(n int, eval func(i int) EvalResult) evalRulesResult {
 	matched := emptyStringSet()
 	successCount := 0
-	results := make([]EvalResult, len(rules))
+	softFailureCount := 0
+	applicableCount := 0
+	results := make([]EvalResult, n)
 
-	for i, rule := range rules {
-		result := rule.Eval(ctx)
+	for i := range results {
+		result := eval(i)
 
-		if result.Success {
+		if result.NotApplicable {
+			// Rules with a path scope still match trust anchors if the
+			// path is unknown.
 			matched.InsertSet(result.Matched)
-			successCount++
+		} else {
+			applicableCount++
+
+			if result.Success {
+				matched.InsertSet(result.Matched)
+				successCount++
+			} else if result.softFailure() {
+				// Soft failures are tolerated, so we also consider their
+				// (partially) matched trust anchors.
+				matched.InsertSet(result.Matched)
+				softFailureCount++
+			}
 		}
 
 		results[i] = result
 	}
 
-	return evalRulesResult{results, matched, successCount}
+	return evalRulesResult{results, matched, successCount, softFailureCount, applicableCount}
 }
 
 // emptyStringSet is a helper to create an empty string set. This is mainly
@@ -5,6 +5,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/Bonial-International-GmbH/sops-check/internal/sops"
 	"github.com/Bonial-International-GmbH/sops-check/internal/stringutils"
 	"github.com/hashicorp/go-set/v3"
 )
@@ -16,7 +17,13 @@ type SarifResult struct {
 	Kind        string `json:"kind"`
 	Message     string `json:"message"`
 	Description string `json:"description"`
-	File        string `json:"file"`
+	// HelpURI links to documentation of the rule. It is empty if there is
+	// none.
+	HelpURI string `json:"helpUri,omitempty"`
+	File    string `json:"file"`
+	// Regions contains the positions within File which caused the result.
+	// It is empty if the positions are unknown.
+	Regions []sops.Region `json:"regions,omitempty"`
 }
 
 // formatBuffer is a helper type for formatting EvalResults.
@@ -40,10 +47,22 @@ func (b *formatBuffer) writeIndented(indentFirst bool, fn func(*formatBuffer)) {
 // result, passing a *formatBuffer which will indent every line written to it
 // by 2 spaces.
 func (b *formatBuffer) writeIndentedList(results []EvalResult, fn func(*formatBuffer, *EvalResult)) {
+	labels := make([]string, len(results))
+	for i := range results {
+		labels[i] = fmt.Sprintf("%d)", i+1)
+	}
+
+	b.writeLabeledList(labels, results, fn)
+}
+
+// writeLabeledList is like writeIndentedList, but prefixes each result with
+// the label at the same index instead of its position in the list.
+func (b *formatBuffer) writeLabeledList(labels []string, results []EvalResult, fn func(*formatBuffer, *EvalResult)) {
 	b.writeIndented(true, func(buf *formatBuffer) {
 		for i, result := range results {
 			buf.WriteRune('\n')
-			fmt.Fprintf(buf, "%d) ", i+1)
+			buf.WriteString(labels[i])
+			buf.WriteRune(' ')
 			buf.writeIndented(false, func(buf *formatBuffer) {
 				fn(buf, &result)
 			})
@@ -56,7 +75,8 @@ func (b *formatBuffer) writeIndentedList(results []EvalResult, fn func(*formatBu
 func formatFailure(buf *formatBuffer, result *EvalResult) {
 	result = result.flatten()
 
-	formatRuleKind(buf, result.Rule.Kind())
+	formatRuleKind(buf, result.Rule)
+	formatSeverity(buf, result.Rule.Meta().Severity)
 	formatRuleMeta(buf, result.Rule.Meta())
 
 	successes, failures := result.partitionNested()
@@ -64,8 +84,48 @@ func formatFailure(buf *formatBuffer, result *EvalResult) {
 	switch r := result.Rule.(type) {
 	case *MatchRule:
 		fmt.Fprintf(buf, "Expected trust anchor %q was not found.\n", r.trustAnchor)
+	case *MatchTypeRule:
+		fmt.Fprintf(buf, "Trust anchor of type %q was not found.\n", r.keyType)
+	case *MatchKMSRule:
+		fmt.Fprintf(buf, "AWS KMS trust anchor matching %s was not found.\n", r.String())
 	case *MatchRegexRule:
 		fmt.Fprintf(buf, "Trust anchor matching regular expression %q was not found.\n", r.pattern.String())
+	case *MetadataRule:
+		buf.WriteString("SOPS metadata does not satisfy the requirements:\n")
+		formatList(buf, result.Violations)
+	case *MaxKeyAgeRule:
+		fmt.Fprintf(buf, "Found trust anchors older than %s:\n", formatAge(r.maxAge))
+		formatList(buf, result.Violations)
+	case *KeyGroupsRule, *ShamirThresholdRule, *MaxLastModifiedAgeRule:
+		buf.WriteString(strings.Join(result.Violations, "\n"))
+		buf.WriteRune('\n')
+	case *InEveryKeyGroupRule:
+		buf.WriteString("Expected nested rule to match in EVERY key group, but ")
+
+		labels, failures := keyGroupFailures(result)
+
+		switch len(failures) {
+		case 0:
+			buf.WriteString("no key groups were found.\n")
+		case 1:
+			buf.WriteString("found one failure:\n")
+		default:
+			fmt.Fprintf(buf, "found %d failures:\n", len(failures))
+		}
+
+		buf.writeLabeledList(labels, failures, formatFailure)
+	case *InAnyKeyGroupRule:
+		buf.WriteString("Expected nested rule to match in ANY key group, but ")
+
+		labels, failures := keyGroupFailures(result)
+
+		if len(failures) == 0 {
+			buf.WriteString("no key groups were found.\n")
+		} else {
+			buf.WriteString("none did:\n")
+		}
+
+		buf.writeLabeledList(labels, failures, formatFailure)
 	case *NotRule:
 		buf.WriteString("Expected nested rule to fail, but it did not:\n")
 		buf.writeIndentedList(successes, formatUnexpectedSuccess)
@@ -87,6 +147,24 @@ func formatFailure(buf *formatBuffer, result *EvalResult) {
 
 		if len(successes) == 0 {
 			buf.WriteString("none did:\n")
+			buf.writeIndentedList(failures, formatFailure)
+		} else {
+			fmt.Fprintf(buf, "found %d:\n", len(successes))
+			buf.writeIndentedList(successes, formatUnexpectedSuccess)
+		}
+	case *RefRule:
+		buf.WriteString("Expected referenced rule to match, but it did not:\n")
+		buf.writeIndentedList(failures, formatFailure)
+	case *NOfRule:
+		fmt.Fprintf(buf, "Expected %s of the nested rules to match, but ", r.quantifier())
+
+		if len(successes) < r.atLeast {
+			if len(successes) == 0 {
+				buf.WriteString("none did:\n")
+			} else {
+				fmt.Fprintf(buf, "only found %d. Failed rules:\n", len(successes))
+			}
+
 			buf.writeIndentedList(failures, formatFailure)
 		} else {
 			fmt.Fprintf(buf, "found %d:\n", len(successes))
@@ -101,23 +179,66 @@ func formatFailure(buf *formatBuffer, result *EvalResult) {
 func formatUnexpectedSuccess(buf *formatBuffer, result *EvalResult) {
 	result = result.flatten()
 
-	formatRuleKind(buf, result.Rule.Kind())
+	formatRuleKind(buf, result.Rule)
 	formatRuleMeta(buf, result.Rule.Meta())
 
-	trustAnchors := result.Matched.Slice()
-	sort.Strings(trustAnchors)
+	switch r := result.Rule.(type) {
+	case *MetadataRule:
+		requirements := make([]string, len(r.checks))
+		for i, check := range r.checks {
+			requirements[i] = check.String()
+		}
+
+		buf.WriteString("SOPS metadata satisfies the requirements:\n")
+		formatList(buf, requirements)
+	case *KeyGroupsRule, *ShamirThresholdRule, *MaxKeyAgeRule, *MaxLastModifiedAgeRule:
+		// These rules do not match trust anchors, so we describe the
+		// requirement that was satisfied instead.
+		buf.WriteString(r.(fmt.Stringer).String())
+		buf.WriteRune('\n')
+	default:
+		buf.WriteString("Matched trust anchors:\n")
+		formatTrustAnchors(buf, result.Matched)
+	}
+}
+
+// keyGroupFailures returns the failed nested results of a rule evaluated per
+// key group, along with labels identifying the key group of each failure.
+func keyGroupFailures(result *EvalResult) (labels []string, failures []EvalResult) {
+	for i, nested := range result.Nested {
+		if !nested.Success {
+			labels = append(labels, fmt.Sprintf("Key group %d:", i+1))
+			failures = append(failures, nested)
+		}
+	}
 
-	buf.WriteString("Matched trust anchors:\n")
-	formatTrustAnchors(buf, result.Matched)
+	return labels, failures
 }
 
-// formatRuleKind writes the formatted rule kind to buf.
-func formatRuleKind(buf *formatBuffer, kind Kind) {
+// formatRuleKind writes the formatted rule kind to buf. For references, the
+// name of the referenced rule definition is included as well.
+func formatRuleKind(buf *formatBuffer, rule Rule) {
 	buf.WriteRune('[')
-	buf.WriteString(string(kind))
+	buf.WriteString(string(rule.Kind()))
+
+	if ref, ok := rule.(*RefRule); ok {
+		buf.WriteString(": ")
+		buf.WriteString(ref.name)
+	}
+
 	buf.WriteString("] ")
 }
 
+// formatSeverity writes the formatted severity to buf, unless it is the
+// default severity.
+func formatSeverity(buf *formatBuffer, severity Severity) {
+	if severity.soft() {
+		buf.WriteRune('(')
+		buf.WriteString(string(severity))
+		buf.WriteString(") ")
+	}
+}
+
 // formatRuleMeta writes formatted rule metadata to buf, if any.
 func formatRuleMeta(buf *formatBuffer, meta Meta) {
 	desc := strings.TrimSpace(meta.Description)
@@ -134,6 +255,12 @@ func formatRuleMeta(buf *formatBuffer, meta Meta) {
 		buf.WriteString(url)
 		buf.WriteString("\n\n")
 	}
+
+	if meta.Scope != nil {
+		buf.WriteString("Applies to paths: ")
+		buf.WriteString(meta.Scope.String())
+		buf.WriteString("\n\n")
+	}
 }
 
 // formatTrustAnchors produces a sorted and properly indented list of trust
@@ -141,11 +268,16 @@ func formatRuleMeta(buf *formatBuffer, meta Meta) {
 func formatTrustAnchors(buf *formatBuffer, items set.Collection[string]) {
 	trustAnchors := items.Slice()
 	sort.Strings(trustAnchors)
+	formatList(buf, trustAnchors)
+}
 
-	for _, trustAnchor := range trustAnchors {
+// formatList produces a properly indented bullet list of items and writes it
+// to buf.
+func formatList(buf *formatBuffer, items []string) {
+	for _, item := range items {
 		buf.writeIndented(true, func(buf *formatBuffer) {
 			buf.WriteString("- ")
-			buf.WriteString(trustAnchor)
+			buf.WriteString(item)
 		})
 		buf.WriteRune('\n')
 	}
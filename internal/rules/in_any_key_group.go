@@ -0,0 +1,42 @@
+package rules
+
+// InAnyKeyGroupRule asserts that a rule matches the trust anchors of at least
+// one key group individually.
+type InAnyKeyGroupRule struct {
+	metaRule
+	rule Rule
+}
+
+// InAnyKeyGroup creates an InAnyKeyGroupRule from a Rule.
+func InAnyKeyGroup(rule Rule) *InAnyKeyGroupRule {
+	return &InAnyKeyGroupRule{rule: rule}
+}
+
+// Kind implements Rule.
+func (*InAnyKeyGroupRule) Kind() Kind {
+	return KindInAnyKeyGroup
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r *InAnyKeyGroupRule) MarshalJSON() ([]byte, error) {
+	return marshalRule(r, ruleJSON{})
+}
+
+// Eval implements Rule.
+func (r *InAnyKeyGroupRule) Eval(ctx *EvalContext) EvalResult {
+	result := evalKeyGroups(ctx, r.rule)
+	if result.notApplicable() {
+		return notApplicable(ctx, r)
+	}
+
+	success, warnings := result.check(1, len(result.results))
+
+	return EvalResult{
+		Rule:      r,
+		Success:   success,
+		Matched:   result.matched,
+		Unmatched: ctx.TrustAnchors.Difference(result.matched),
+		Nested:    result.results,
+		Warnings:  warnings,
+	}
+}
@@ -0,0 +1,46 @@
+package rules
+
+// InEveryKeyGroupRule asserts that a rule matches the trust anchors of every
+// key group individually.
+type InEveryKeyGroupRule struct {
+	metaRule
+	rule Rule
+}
+
+// InEveryKeyGroup creates an InEveryKeyGroupRule from a Rule.
+func InEveryKeyGroup(rule Rule) *InEveryKeyGroupRule {
+	return &InEveryKeyGroupRule{rule: rule}
+}
+
+// Kind implements Rule.
+func (*InEveryKeyGroupRule) Kind() Kind {
+	return KindInEveryKeyGroup
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r *InEveryKeyGroupRule) MarshalJSON() ([]byte, error) {
+	return marshalRule(r, ruleJSON{})
+}
+
+// Eval implements Rule.
+func (r *InEveryKeyGroupRule) Eval(ctx *EvalContext) EvalResult {
+	result := evalKeyGroups(ctx, r.rule)
+	if result.notApplicable() {
+		return notApplicable(ctx, r)
+	}
+
+	// A file without key groups cannot satisfy the rule.
+	success, warnings := false, []EvalResult(nil)
+	if len(ctx.KeyGroups) > 0 {
+		success, warnings = result.check(result.applicableCount, result.applicableCount)
+	}
+
+	return EvalResult{
+		Rule:      r,
+		Success:   success,
+		Matched:   result.matched,
+		Unmatched: ctx.TrustAnchors.Difference(result.matched),
+		Nested:    result.results,
+		Warnings:  warnings,
+	}
+}
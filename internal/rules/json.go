@@ -0,0 +1,105 @@
+package rules
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/Bonial-International-GmbH/sops-check/internal/sops"
+	"github.com/hashicorp/go-set/v3"
+)
+
+// ruleJSON is the JSON representation of a rule. Besides the kind and the
+// metadata common to all rules, it contains the parameters of the rule. Fields
+// which do not apply to a kind of rule are omitted. Nested rules are not
+// included, they are part of the nested results instead.
+type ruleJSON struct {
+	Kind         Kind              `json:"kind"`
+	ID           string            `json:"id,omitempty"`
+	Description  string            `json:"description,omitempty"`
+	URL          string            `json:"url,omitempty"`
+	Severity     Severity          `json:"severity,omitempty"`
+	Paths        []string          `json:"paths,omitempty"`
+	ExcludePaths []string          `json:"excludePaths,omitempty"`
+	TrustAnchor  string            `json:"trustAnchor,omitempty"`
+	Pattern      string            `json:"pattern,omitempty"`
+	KeyType      sops.KeyType      `json:"keyType,omitempty"`
+	Fields       map[string]string `json:"fields,omitempty"`
+	MaxAge       string            `json:"maxAge,omitempty"`
+	Min          *int              `json:"min,omitempty"`
+	Max          *int              `json:"max,omitempty"`
+	AtLeast      *int              `json:"atLeast,omitempty"`
+	AtMost       *int              `json:"atMost,omitempty"`
+	Checks       []string          `json:"checks,omitempty"`
+	Ref          string            `json:"ref,omitempty"`
+}
+
+// marshalRule marshals rule to JSON, adding its kind and metadata to the
+// parameters in params.
+func marshalRule(rule Rule, params ruleJSON) ([]byte, error) {
+	meta := rule.Meta()
+
+	params.Kind = rule.Kind()
+	params.ID = meta.ID
+	params.Description = meta.Description
+	params.URL = meta.URL
+	params.Severity = meta.Severity
+
+	if meta.Scope != nil {
+		params.Paths = meta.Scope.paths
+		params.ExcludePaths = meta.Scope.excludePaths
+	}
+
+	return json.Marshal(params)
+}
+
+// rangeJSON returns the parameters of a rule asserting that a count lies
+// within r. The max bound is omitted if there is none.
+func rangeJSON(r countRange) ruleJSON {
+	params := ruleJSON{Min: &r.min}
+
+	if r.max >= 0 {
+		params.Max = &r.max
+	}
+
+	return params
+}
+
+// evalResultJSON is the JSON representation of an EvalResult.
+type evalResultJSON struct {
+	Rule          Rule         `json:"rule"`
+	Success       bool         `json:"success"`
+	NotApplicable bool         `json:"notApplicable,omitempty"`
+	Matched       []string     `json:"matched"`
+	Unmatched     []string     `json:"unmatched"`
+	Violations    []string     `json:"violations,omitempty"`
+	Nested        []EvalResult `json:"nested,omitempty"`
+	Warnings      []EvalResult `json:"warnings,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. Trust anchors are sorted, so that the
+// output is stable.
+func (r *EvalResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(evalResultJSON{
+		Rule:          r.Rule,
+		Success:       r.Success,
+		NotApplicable: r.NotApplicable,
+		Matched:       sortedTrustAnchors(r.Matched),
+		Unmatched:     sortedTrustAnchors(r.Unmatched),
+		Violations:    r.Violations,
+		Nested:        r.Nested,
+		Warnings:      r.Warnings,
+	})
+}
+
+// sortedTrustAnchors returns the trust anchors in items in sorted order. It
+// never returns nil, so that empty sets are marshaled as empty arrays.
+func sortedTrustAnchors(items set.Collection[string]) []string {
+	if items == nil {
+		return []string{}
+	}
+
+	trustAnchors := items.Slice()
+	sort.Strings(trustAnchors)
+
+	return trustAnchors
+}
@@ -0,0 +1,77 @@
+package rules
+
+import "fmt"
+
+// countRange is an inclusive range of counts. A negative max means that there
+// is no upper bound.
+type countRange struct {
+	min int
+	max int
+}
+
+// contains returns true if n lies within the range.
+func (r countRange) contains(n int) bool {
+	return n >= r.min && (r.max < 0 || n <= r.max)
+}
+
+// String returns a human readable representation of the range.
+func (r countRange) String() string {
+	switch {
+	case r.min == r.max:
+		return fmt.Sprintf("exactly %d", r.min)
+	case r.max < 0:
+		return fmt.Sprintf("at least %d", r.min)
+	case r.min == 0:
+		return fmt.Sprintf("at most %d", r.max)
+	default:
+		return fmt.Sprintf("between %d and %d", r.min, r.max)
+	}
+}
+
+// KeyGroupsRule asserts that the number of key groups of a file lies within a
+// user-defined range. It does not match any trust anchors.
+type KeyGroupsRule struct {
+	metaRule
+	count countRange
+}
+
+// KeyGroups creates a KeyGroupsRule which asserts that a file has at least
+// min and at most max key groups. A negative max means that there is no upper
+// bound.
+func KeyGroups(min, max int) *KeyGroupsRule {
+	return &KeyGroupsRule{count: countRange{min: min, max: max}}
+}
+
+// Kind implements Rule.
+func (*KeyGroupsRule) Kind() Kind {
+	return KindKeyGroups
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r *KeyGroupsRule) MarshalJSON() ([]byte, error) {
+	return marshalRule(r, rangeJSON(r.count))
+}
+
+// Eval implements Rule.
+func (r *KeyGroupsRule) Eval(ctx *EvalContext) EvalResult {
+	var violations []string
+
+	if n := len(ctx.KeyGroups); !r.count.contains(n) {
+		violations = append(violations, fmt.Sprintf("Expected %s key groups, but found %d.", r.count, n))
+	}
+
+	matched := emptyStringSet()
+
+	return EvalResult{
+		Rule:       r,
+		Success:    len(violations) == 0,
+		Matched:    matched,
+		Unmatched:  ctx.TrustAnchors.Difference(matched),
+		Violations: violations,
+	}
+}
+
+// String returns a human readable description of the requirement.
+func (r *KeyGroupsRule) String() string {
+	return fmt.Sprintf("Number of key groups is %s.", r.count)
+}
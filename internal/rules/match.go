@@ -16,6 +16,11 @@ func (*MatchRule) Kind() Kind {
 	return KindMatch
 }
 
+// MarshalJSON implements json.Marshaler.
+func (r *MatchRule) MarshalJSON() ([]byte, error) {
+	return marshalRule(r, ruleJSON{TrustAnchor: r.trustAnchor})
+}
+
 // Eval implements Rule.
 func (r *MatchRule) Eval(ctx *EvalContext) EvalResult {
 	matched := emptyStringSet()
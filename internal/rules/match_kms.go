@@ -0,0 +1,93 @@
+package rules
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Bonial-International-GmbH/sops-check/internal/sops"
+)
+
+// MatchKMSRule asserts that AWS KMS trust anchors whose fields match
+// user-defined glob patterns are present.
+type MatchKMSRule struct {
+	metaRule
+	// patterns maps trust anchor fields to shell-style glob patterns.
+	patterns map[string]string
+}
+
+// MatchKMS creates a MatchKMSRule which matches AWS KMS trust anchors whose
+// fields match all of the given glob patterns. Patterns are keyed by field
+// name, e.g. sops.FieldAccount or sops.FieldRegion. Returns an error if any
+// of the patterns is malformed.
+func MatchKMS(patterns map[string]string) (*MatchKMSRule, error) {
+	for field, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q for field %s: %w", pattern, field, err)
+		}
+	}
+
+	return &MatchKMSRule{patterns: patterns}, nil
+}
+
+// Kind implements Rule.
+func (*MatchKMSRule) Kind() Kind {
+	return KindMatchKMS
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r *MatchKMSRule) MarshalJSON() ([]byte, error) {
+	return marshalRule(r, ruleJSON{Fields: r.patterns})
+}
+
+// Eval implements Rule.
+func (r *MatchKMSRule) Eval(ctx *EvalContext) EvalResult {
+	matched := emptyStringSet()
+
+	for trustAnchor := range ctx.TrustAnchors.Items() {
+		if r.matches(ctx.trustAnchor(trustAnchor)) {
+			matched.Insert(trustAnchor)
+		}
+	}
+
+	return EvalResult{
+		Rule:      r,
+		Success:   !matched.Empty(),
+		Matched:   matched,
+		Unmatched: ctx.TrustAnchors.Difference(matched),
+	}
+}
+
+// matches returns true if anchor is an AWS KMS trust anchor whose fields
+// match all patterns.
+func (r *MatchKMSRule) matches(anchor sops.TrustAnchor) bool {
+	if anchor.Type != sops.KeyTypeKMS {
+		return false
+	}
+
+	for field, pattern := range r.patterns {
+		if ok, _ := path.Match(pattern, anchor.Fields[field]); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns a human readable representation of the patterns.
+func (r *MatchKMSRule) String() string {
+	fields := make([]string, 0, len(r.patterns))
+
+	for field := range r.patterns {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	for i, field := range fields {
+		fields[i] = fmt.Sprintf("%s=%q", field, r.patterns[field])
+	}
+
+	return strings.Join(fields, ", ")
+}
@@ -19,6 +19,11 @@ func (*MatchRegexRule) Kind() Kind {
 	return KindMatchRegex
 }
 
+// MarshalJSON implements json.Marshaler.
+func (r *MatchRegexRule) MarshalJSON() ([]byte, error) {
+	return marshalRule(r, ruleJSON{Pattern: r.pattern.String()})
+}
+
 // Eval implements Rule.
 func (r *MatchRegexRule) Eval(ctx *EvalContext) EvalResult {
 	matched := emptyStringSet()
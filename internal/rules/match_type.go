@@ -0,0 +1,42 @@
+package rules
+
+import "github.com/Bonial-International-GmbH/sops-check/internal/sops"
+
+// MatchTypeRule asserts that trust anchors of a given key type are present.
+type MatchTypeRule struct {
+	metaRule
+	keyType sops.KeyType
+}
+
+// MatchType creates a MatchTypeRule for the given key type.
+func MatchType(keyType sops.KeyType) *MatchTypeRule {
+	return &MatchTypeRule{keyType: keyType}
+}
+
+// Kind implements Rule.
+func (*MatchTypeRule) Kind() Kind {
+	return KindMatchType
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r *MatchTypeRule) MarshalJSON() ([]byte, error) {
+	return marshalRule(r, ruleJSON{KeyType: r.keyType})
+}
+
+// Eval implements Rule.
+func (r *MatchTypeRule) Eval(ctx *EvalContext) EvalResult {
+	matched := emptyStringSet()
+
+	for trustAnchor := range ctx.TrustAnchors.Items() {
+		if ctx.trustAnchor(trustAnchor).Type == r.keyType {
+			matched.Insert(trustAnchor)
+		}
+	}
+
+	return EvalResult{
+		Rule:      r,
+		Success:   !matched.Empty(),
+		Matched:   matched,
+		Unmatched: ctx.TrustAnchors.Difference(matched),
+	}
+}
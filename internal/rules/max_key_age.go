@@ -0,0 +1,77 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MaxKeyAgeRule asserts that no trust anchor was used to encrypt the data key
+// longer ago than a given maximum age. Trust anchors without a creation time
+// are ignored. It does not match any trust anchors.
+type MaxKeyAgeRule struct {
+	metaRule
+	maxAge time.Duration
+}
+
+// MaxKeyAge creates a MaxKeyAgeRule for the given maximum age.
+func MaxKeyAge(maxAge time.Duration) *MaxKeyAgeRule {
+	return &MaxKeyAgeRule{maxAge: maxAge}
+}
+
+// Kind implements Rule.
+func (*MaxKeyAgeRule) Kind() Kind {
+	return KindMaxKeyAge
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r *MaxKeyAgeRule) MarshalJSON() ([]byte, error) {
+	return marshalRule(r, ruleJSON{MaxAge: formatAge(r.maxAge)})
+}
+
+// Eval implements Rule.
+func (r *MaxKeyAgeRule) Eval(ctx *EvalContext) EvalResult {
+	trustAnchors := ctx.TrustAnchors.Slice()
+	sort.Strings(trustAnchors)
+
+	now := ctx.now()
+
+	var violations []string
+
+	for _, trustAnchor := range trustAnchors {
+		createdAt := ctx.trustAnchor(trustAnchor).CreatedAt
+		if createdAt.IsZero() {
+			continue
+		}
+
+		if age := now.Sub(createdAt); age > r.maxAge {
+			violations = append(violations, fmt.Sprintf("%s (created at %s, %s ago)",
+				trustAnchor, createdAt.UTC().Format(time.RFC3339), formatAge(age)))
+		}
+	}
+
+	matched := emptyStringSet()
+
+	return EvalResult{
+		Rule:       r,
+		Success:    len(violations) == 0,
+		Matched:    matched,
+		Unmatched:  ctx.TrustAnchors.Difference(matched),
+		Violations: violations,
+	}
+}
+
+// String returns a human readable description of the requirement.
+func (r *MaxKeyAgeRule) String() string {
+	return fmt.Sprintf("No trust anchor is older than %s.", formatAge(r.maxAge))
+}
+
+// formatAge formats a duration in whole days if it is at least one day, and
+// using time.Duration.String otherwise.
+func formatAge(d time.Duration) string {
+	if d >= 24*time.Hour {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+
+	return d.Truncate(time.Second).String()
+}
@@ -0,0 +1,61 @@
+package rules
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxLastModifiedAgeRule asserts that a file was last modified no longer ago
+// than a given maximum age. It does not match any trust anchors.
+type MaxLastModifiedAgeRule struct {
+	metaRule
+	maxAge time.Duration
+}
+
+// MaxLastModifiedAge creates a MaxLastModifiedAgeRule for the given maximum
+// age.
+func MaxLastModifiedAge(maxAge time.Duration) *MaxLastModifiedAgeRule {
+	return &MaxLastModifiedAgeRule{maxAge: maxAge}
+}
+
+// Kind implements Rule.
+func (*MaxLastModifiedAgeRule) Kind() Kind {
+	return KindMaxLastModifiedAge
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r *MaxLastModifiedAgeRule) MarshalJSON() ([]byte, error) {
+	return marshalRule(r, ruleJSON{MaxAge: formatAge(r.maxAge)})
+}
+
+// Eval implements Rule.
+func (r *MaxLastModifiedAgeRule) Eval(ctx *EvalContext) EvalResult {
+	var violations []string
+
+	var lastModified time.Time
+	if ctx.Metadata != nil {
+		lastModified = ctx.Metadata.LastModified
+	}
+
+	if lastModified.IsZero() {
+		violations = append(violations, fmt.Sprintf("Expected file to be modified within the last %s, but the time of the last modification is unknown.", formatAge(r.maxAge)))
+	} else if age := ctx.now().Sub(lastModified); age > r.maxAge {
+		violations = append(violations, fmt.Sprintf("Expected file to be modified within the last %s, but it was last modified at %s (%s ago).",
+			formatAge(r.maxAge), lastModified.UTC().Format(time.RFC3339), formatAge(age)))
+	}
+
+	matched := emptyStringSet()
+
+	return EvalResult{
+		Rule:       r,
+		Success:    len(violations) == 0,
+		Matched:    matched,
+		Unmatched:  ctx.TrustAnchors.Difference(matched),
+		Violations: violations,
+	}
+}
+
+// String returns a human readable description of the requirement.
+func (r *MaxLastModifiedAgeRule) String() string {
+	return fmt.Sprintf("File was modified within the last %s.", formatAge(r.maxAge))
+}
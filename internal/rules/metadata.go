@@ -0,0 +1,326 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	gosops "github.com/getsops/sops/v3"
+)
+
+// MetadataField is the name of a SOPS metadata field as it appears in SOPS
+// files.
+type MetadataField string
+
+const (
+	// MetadataEncryptedRegex restricts encryption to values of keys
+	// matching a regular expression.
+	MetadataEncryptedRegex MetadataField = "encrypted_regex"
+	// MetadataEncryptedSuffix restricts encryption to values of keys ending
+	// with a suffix.
+	MetadataEncryptedSuffix MetadataField = "encrypted_suffix"
+	// MetadataUnencryptedRegex excludes values of keys matching a regular
+	// expression from encryption.
+	MetadataUnencryptedRegex MetadataField = "unencrypted_regex"
+	// MetadataUnencryptedSuffix excludes values of keys ending with a suffix
+	// from encryption.
+	MetadataUnencryptedSuffix MetadataField = "unencrypted_suffix"
+	// MetadataEncryptedCommentRegex restricts encryption to values whose
+	// preceding comment matches a regular expression.
+	MetadataEncryptedCommentRegex MetadataField = "encrypted_comment_regex"
+	// MetadataUnencryptedCommentRegex excludes values whose preceding
+	// comment matches a regular expression from encryption.
+	MetadataUnencryptedCommentRegex MetadataField = "unencrypted_comment_regex"
+)
+
+// value returns the value of the field in metadata.
+func (f MetadataField) value(metadata *gosops.Metadata) string {
+	switch f {
+	case MetadataEncryptedRegex:
+		return metadata.EncryptedRegex
+	case MetadataEncryptedSuffix:
+		return metadata.EncryptedSuffix
+	case MetadataUnencryptedRegex:
+		return metadata.UnencryptedRegex
+	case MetadataUnencryptedSuffix:
+		return metadata.UnencryptedSuffix
+	case MetadataEncryptedCommentRegex:
+		return metadata.EncryptedCommentRegex
+	case MetadataUnencryptedCommentRegex:
+		return metadata.UnencryptedCommentRegex
+	default:
+		return ""
+	}
+}
+
+// MetadataCheck is a single requirement for SOPS metadata.
+type MetadataCheck interface {
+	// String returns a human readable description of the requirement.
+	String() string
+	// check returns a human readable description of the violation if the
+	// requirement is not satisfied by metadata, or an empty string otherwise.
+	check(metadata *gosops.Metadata) string
+}
+
+// MetadataRule asserts that the SOPS metadata of a file satisfies all of the
+// given requirements. It does not match any trust anchors.
+type MetadataRule struct {
+	metaRule
+	checks []MetadataCheck
+}
+
+// Metadata creates a MetadataRule from a list of requirements.
+func Metadata(checks ...MetadataCheck) *MetadataRule {
+	return &MetadataRule{checks: checks}
+}
+
+// Kind implements Rule.
+func (*MetadataRule) Kind() Kind {
+	return KindMetadata
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r *MetadataRule) MarshalJSON() ([]byte, error) {
+	checks := make([]string, len(r.checks))
+	for i, check := range r.checks {
+		checks[i] = check.String()
+	}
+
+	return marshalRule(r, ruleJSON{Checks: checks})
+}
+
+// Eval implements Rule.
+func (r *MetadataRule) Eval(ctx *EvalContext) EvalResult {
+	metadata := ctx.Metadata
+	if metadata == nil {
+		metadata = &gosops.Metadata{}
+	}
+
+	var violations []string
+
+	for _, check := range r.checks {
+		if _, ok := check.(*minVersion); ok && ctx.UnknownVersion {
+			continue
+		}
+
+		if violation := check.check(metadata); violation != "" {
+			violations = append(violations, violation)
+		}
+	}
+
+	matched := emptyStringSet()
+
+	return EvalResult{
+		Rule:       r,
+		Success:    len(violations) == 0,
+		Matched:    matched,
+		Unmatched:  ctx.TrustAnchors.Difference(matched),
+		Violations: violations,
+	}
+}
+
+// fieldPresence requires a metadata field to be either set or unset.
+type fieldPresence struct {
+	field    MetadataField
+	required bool
+}
+
+// RequireField creates a MetadataCheck which requires field to be set.
+func RequireField(field MetadataField) MetadataCheck {
+	return &fieldPresence{field: field, required: true}
+}
+
+// ForbidField creates a MetadataCheck which requires field to be unset.
+func ForbidField(field MetadataField) MetadataCheck {
+	return &fieldPresence{field: field, required: false}
+}
+
+func (c *fieldPresence) String() string {
+	if c.required {
+		return fmt.Sprintf("%s is set", c.field)
+	}
+
+	return fmt.Sprintf("%s is not set", c.field)
+}
+
+func (c *fieldPresence) check(metadata *gosops.Metadata) string {
+	value := c.field.value(metadata)
+
+	if c.required && value == "" {
+		return fmt.Sprintf("%s must be set, but it is not", c.field)
+	}
+
+	if !c.required && value != "" {
+		return fmt.Sprintf("%s must not be set, but it is set to %q", c.field, value)
+	}
+
+	return ""
+}
+
+// macOnlyEncrypted requires mac_only_encrypted to have a given value.
+type macOnlyEncrypted struct {
+	value bool
+}
+
+// RequireMACOnlyEncrypted creates a MetadataCheck which requires the
+// mac_only_encrypted field to be equal to value.
+func RequireMACOnlyEncrypted(value bool) MetadataCheck {
+	return &macOnlyEncrypted{value: value}
+}
+
+func (c *macOnlyEncrypted) String() string {
+	return fmt.Sprintf("mac_only_encrypted is %t", c.value)
+}
+
+func (c *macOnlyEncrypted) check(metadata *gosops.Metadata) string {
+	if metadata.MACOnlyEncrypted != c.value {
+		return fmt.Sprintf("mac_only_encrypted must be %t, but it is %t", c.value, metadata.MACOnlyEncrypted)
+	}
+
+	return ""
+}
+
+// minVersion requires the SOPS version that was used to encrypt a file to be
+// greater than or equal to a given version.
+type minVersion struct {
+	version version
+}
+
+// MinVersion creates a MetadataCheck which requires the SOPS version that
+// was used to encrypt a file to be greater than or equal to version. Returns
+// an error if version is not a valid semantic version.
+func MinVersion(version string) (MetadataCheck, error) {
+	v, err := parseVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid minimum version %q: %w", version, err)
+	}
+
+	return &minVersion{version: v}, nil
+}
+
+func (c *minVersion) String() string {
+	return fmt.Sprintf("version is at least %s", c.version)
+}
+
+func (c *minVersion) check(metadata *gosops.Metadata) string {
+	if metadata.Version == "" {
+		return fmt.Sprintf("version must be at least %s, but it is unknown", c.version)
+	}
+
+	v, err := parseVersion(metadata.Version)
+	if err != nil {
+		return fmt.Sprintf("version must be at least %s, but %q is not a valid version", c.version, metadata.Version)
+	}
+
+	if v.less(c.version) {
+		return fmt.Sprintf("version must be at least %s, but it is %s", c.version, metadata.Version)
+	}
+
+	return ""
+}
+
+// version is the major, minor and patch number of a SOPS version.
+type version [3]int
+
+// parseVersion parses versions like `3.9.4`, `v3.9` or `3.10.0-rc.1`. Missing
+// minor and patch numbers are 0, and pre-release and build suffixes are
+// ignored.
+func parseVersion(s string) (version, error) {
+	var v version
+
+	core := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(core, "-+"); i >= 0 {
+		core = core[:i]
+	}
+
+	parts := strings.Split(core, ".")
+	if len(parts) > len(v) {
+		return v, fmt.Errorf("expected at most %d numbers separated by dots", len(v))
+	}
+
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("%q is not a version number", part)
+		}
+
+		v[i] = n
+	}
+
+	return v, nil
+}
+
+func (v version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// less returns true if v is lower than other.
+func (v version) less(other version) bool {
+	return slices.Compare(v[:], other[:]) < 0
+}
+
+// encryptedKeys requires keys with the given names to be encrypted according
+// to the encryption settings found in the metadata.
+type encryptedKeys struct {
+	keys []string
+}
+
+// RequireEncryptedKeys creates a MetadataCheck which requires keys with the
+// given names to be encrypted. This is violated if the unencrypted_suffix,
+// encrypted_suffix, unencrypted_regex or encrypted_regex settings of a file
+// would leave any of these keys unencrypted.
+func RequireEncryptedKeys(keys ...string) MetadataCheck {
+	return &encryptedKeys{keys: keys}
+}
+
+func (c *encryptedKeys) String() string {
+	return fmt.Sprintf("keys %s are encrypted", strings.Join(c.keys, ", "))
+}
+
+func (c *encryptedKeys) check(metadata *gosops.Metadata) string {
+	var reasons []string
+
+	for _, key := range c.keys {
+		if reason := unencryptedReason(metadata, key); reason != "" {
+			reasons = append(reasons, fmt.Sprintf("%q (%s)", key, reason))
+		}
+	}
+
+	if len(reasons) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("keys must be encrypted, but the following would not be: %s", strings.Join(reasons, ", "))
+}
+
+// unencryptedReason returns the reason why SOPS would not encrypt the value of
+// key given the encryption settings in metadata, or an empty string if the
+// value would be encrypted. This mirrors the behaviour of SOPS itself.
+func unencryptedReason(metadata *gosops.Metadata, key string) string {
+	if metadata.UnencryptedSuffix != "" && strings.HasSuffix(key, metadata.UnencryptedSuffix) {
+		return fmt.Sprintf("has unencrypted_suffix %q", metadata.UnencryptedSuffix)
+	}
+
+	if metadata.EncryptedSuffix != "" && !strings.HasSuffix(key, metadata.EncryptedSuffix) {
+		return fmt.Sprintf("lacks encrypted_suffix %q", metadata.EncryptedSuffix)
+	}
+
+	if metadata.UnencryptedRegex != "" && matchesRegex(metadata.UnencryptedRegex, key) {
+		return fmt.Sprintf("matches unencrypted_regex %q", metadata.UnencryptedRegex)
+	}
+
+	if metadata.EncryptedRegex != "" && !matchesRegex(metadata.EncryptedRegex, key) {
+		return fmt.Sprintf("does not match encrypted_regex %q", metadata.EncryptedRegex)
+	}
+
+	return ""
+}
+
+// matchesRegex returns true if pattern matches s. Invalid patterns never
+// match.
+func matchesRegex(pattern, s string) bool {
+	re, err := regexp.Compile(pattern)
+	return err == nil && re.MatchString(s)
+}
@@ -0,0 +1,77 @@
+package rules
+
+import "fmt"
+
+// NOfRule asserts that the number of matching nested rules lies within a
+// user-defined range.
+type NOfRule struct {
+	metaRule
+	rules   []Rule
+	atLeast int
+	atMost  int
+}
+
+// NOf creates an NOfRule which asserts that at least atLeast and at most
+// atMost of the rules match.
+func NOf(atLeast, atMost int, rules ...Rule) *NOfRule {
+	return &NOfRule{rules: rules, atLeast: atLeast, atMost: atMost}
+}
+
+// AtLeast creates an NOfRule which asserts that at least n of the rules match.
+func AtLeast(n int, rules ...Rule) *NOfRule {
+	return NOf(n, len(rules), rules...)
+}
+
+// AtMost creates an NOfRule which asserts that at most n of the rules match.
+func AtMost(n int, rules ...Rule) *NOfRule {
+	return NOf(0, n, rules...)
+}
+
+// Exactly creates an NOfRule which asserts that exactly n of the rules match.
+func Exactly(n int, rules ...Rule) *NOfRule {
+	return NOf(n, n, rules...)
+}
+
+// Kind implements Rule.
+func (*NOfRule) Kind() Kind {
+	return KindNOf
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r *NOfRule) MarshalJSON() ([]byte, error) {
+	return marshalRule(r, ruleJSON{AtLeast: &r.atLeast, AtMost: &r.atMost})
+}
+
+// Eval implements Rule.
+func (r *NOfRule) Eval(ctx *EvalContext) EvalResult {
+	result := evalRules(ctx, r.rules)
+	if result.notApplicable() {
+		return notApplicable(ctx, r)
+	}
+
+	success, warnings := result.check(r.atLeast, r.atMost)
+
+	return EvalResult{
+		Rule:      r,
+		Success:   success,
+		Matched:   result.matched,
+		Unmatched: ctx.TrustAnchors.Difference(result.matched),
+		Nested:    result.results,
+		Warnings:  warnings,
+	}
+}
+
+// quantifier returns a human readable description of the expected number of
+// matching nested rules.
+func (r *NOfRule) quantifier() string {
+	switch {
+	case r.atLeast == r.atMost:
+		return fmt.Sprintf("EXACTLY %d", r.atLeast)
+	case r.atMost == len(r.rules):
+		return fmt.Sprintf("AT LEAST %d", r.atLeast)
+	case r.atLeast == 0:
+		return fmt.Sprintf("AT MOST %d", r.atMost)
+	default:
+		return fmt.Sprintf("BETWEEN %d AND %d", r.atLeast, r.atMost)
+	}
+}
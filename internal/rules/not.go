@@ -16,9 +16,17 @@ func (*NotRule) Kind() Kind {
 	return KindNot
 }
 
+// MarshalJSON implements json.Marshaler.
+func (r *NotRule) MarshalJSON() ([]byte, error) {
+	return marshalRule(r, ruleJSON{})
+}
+
 // Eval implements Rule.
 func (r *NotRule) Eval(ctx *EvalContext) EvalResult {
-	result := r.rule.Eval(ctx)
+	result := evalRule(ctx, r.rule)
+	if result.NotApplicable {
+		return notApplicable(ctx, r)
+	}
 
 	// Invert the result.
 	return EvalResult{
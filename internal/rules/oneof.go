@@ -16,15 +16,26 @@ func (*OneOfRule) Kind() Kind {
 	return KindOneOf
 }
 
+// MarshalJSON implements json.Marshaler.
+func (r *OneOfRule) MarshalJSON() ([]byte, error) {
+	return marshalRule(r, ruleJSON{})
+}
+
 // Eval implements Rule.
 func (r *OneOfRule) Eval(ctx *EvalContext) EvalResult {
 	result := evalRules(ctx, r.rules)
+	if result.notApplicable() {
+		return notApplicable(ctx, r)
+	}
+
+	success, warnings := result.check(1, 1)
 
 	return EvalResult{
 		Rule:      r,
-		Success:   result.successCount == 1,
+		Success:   success,
 		Matched:   result.matched,
 		Unmatched: ctx.TrustAnchors.Difference(result.matched),
 		Nested:    result.results,
+		Warnings:  warnings,
 	}
 }
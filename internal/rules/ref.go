@@ -0,0 +1,48 @@
+package rules
+
+// RefRule evaluates a named rule definition.
+type RefRule struct {
+	metaRule
+	name string
+	rule Rule
+}
+
+// Ref creates a RefRule which references the rule definition with the given
+// name.
+func Ref(name string, rule Rule) *RefRule {
+	return &RefRule{name: name, rule: rule}
+}
+
+// Kind implements Rule.
+func (*RefRule) Kind() Kind {
+	return KindRef
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r *RefRule) MarshalJSON() ([]byte, error) {
+	return marshalRule(r, ruleJSON{Ref: r.name})
+}
+
+// Eval implements Rule.
+func (r *RefRule) Eval(ctx *EvalContext) EvalResult {
+	result := evalRule(ctx, r.rule)
+	if result.NotApplicable {
+		return notApplicable(ctx, r)
+	}
+
+	success, warnings := result.Success, result.Warnings
+
+	// Soft failures of the referenced rule are tolerated.
+	if result.softFailure() {
+		success, warnings = true, []EvalResult{result}
+	}
+
+	return EvalResult{
+		Rule:      r,
+		Success:   success,
+		Matched:   result.Matched,
+		Unmatched: result.Unmatched,
+		Nested:    []EvalResult{result},
+		Warnings:  warnings,
+	}
+}
@@ -4,6 +4,9 @@ package rules
 
 // Meta describes metadata common to all available rules.
 type Meta struct {
+	// ID identifies the rule in reports. It is unique among all rules
+	// compiled from the same configuration.
+	ID string
 	// Description may contain the description of the rule. If the description
 	// is not empty, it is used to enrich error messages presented to the user.
 	Description string
@@ -11,6 +14,31 @@ type Meta struct {
 	// explains the purpose of a rule. If non-empty, it is used to enrich error
 	// messages presented to the user.
 	URL string
+	// Scope restricts the evaluation of the rule to files matching certain
+	// paths. Rules are evaluated for all files if the scope is nil.
+	Scope *Scope
+	// Severity controls how a failure of the rule is reported. Failures of
+	// rules with a severity other than SeverityError are soft failures which
+	// do not fail the check. Defaults to SeverityError if empty.
+	Severity Severity
+}
+
+// Severity represents the severity of a rule failure.
+type Severity string
+
+const (
+	// SeverityError indicates that a rule failure fails the check.
+	SeverityError Severity = "error"
+	// SeverityWarning indicates that a rule failure is reported as a warning.
+	SeverityWarning Severity = "warning"
+	// SeverityNote indicates that a rule failure is reported as a note.
+	SeverityNote Severity = "note"
+)
+
+// soft returns true if failures of a rule with this severity should not fail
+// the check.
+func (s Severity) soft() bool {
+	return s == SeverityWarning || s == SeverityNote
 }
 
 // Kind represents the kind of a rule.
@@ -21,14 +49,44 @@ const (
 	KindAllOf Kind = "allOf"
 	// AnyOf asserts that at least one of the nested rules matches.
 	KindAnyOf Kind = "anyOf"
+	// InAnyKeyGroup asserts that a rule matches the trust anchors of at least
+	// one key group.
+	KindInAnyKeyGroup Kind = "inAnyKeyGroup"
+	// InEveryKeyGroup asserts that a rule matches the trust anchors of every
+	// key group.
+	KindInEveryKeyGroup Kind = "inEveryKeyGroup"
+	// KeyGroups asserts that the number of key groups lies within a given
+	// range.
+	KindKeyGroups Kind = "keyGroups"
 	// Match defines a string to match trust anchors against.
 	KindMatch Kind = "match"
+	// MatchKMS defines glob patterns to match fields of AWS KMS trust anchors
+	// against.
+	KindMatchKMS Kind = "matchKms"
 	// MatchRegex defines a regular expression to match trust anchors against.
 	KindMatchRegex Kind = "matchRegex"
+	// MatchType defines a key type to match trust anchors against.
+	KindMatchType Kind = "matchType"
+	// MaxKeyAge asserts that no trust anchor is older than a given age.
+	KindMaxKeyAge Kind = "maxKeyAge"
+	// MaxLastModifiedAge asserts that a file was modified within a given
+	// age.
+	KindMaxLastModifiedAge Kind = "maxLastModifiedAge"
+	// Metadata asserts that the SOPS metadata of a file satisfies a set of
+	// requirements.
+	KindMetadata Kind = "metadata"
+	// NOf asserts that the number of matching nested rules lies within a
+	// given range.
+	KindNOf Kind = "nOf"
 	// Not inverts the matching behaviour of a rule.
 	KindNot Kind = "not"
 	// OneOf asserts that exactly one of the nested rules matches.
 	KindOneOf Kind = "oneOf"
+	// Ref evaluates a named rule definition.
+	KindRef Kind = "ref"
+	// ShamirThreshold asserts that the number of key groups required for
+	// decryption lies within a given range.
+	KindShamirThreshold Kind = "shamirThreshold"
 )
 
 // Rule is the interface implemented by all available rules.
@@ -43,6 +101,49 @@ type Rule interface {
 	Eval(ctx *EvalContext) EvalResult
 }
 
+// Walk calls fn for rule and all rules nested within it in depth-first order.
+// Rule definitions which are referenced multiple times are only visited once.
+func Walk(rule Rule, fn func(Rule)) {
+	walk(rule, fn, make(map[Rule]bool))
+}
+
+func walk(rule Rule, fn func(Rule), visited map[Rule]bool) {
+	if visited[rule] {
+		return
+	}
+
+	visited[rule] = true
+	fn(rule)
+
+	for _, nested := range nestedRules(rule) {
+		walk(nested, fn, visited)
+	}
+}
+
+// nestedRules returns the rules nested directly within rule.
+func nestedRules(rule Rule) []Rule {
+	switch r := rule.(type) {
+	case *AllOfRule:
+		return r.rules
+	case *AnyOfRule:
+		return r.rules
+	case *OneOfRule:
+		return r.rules
+	case *NOfRule:
+		return r.rules
+	case *NotRule:
+		return []Rule{r.rule}
+	case *RefRule:
+		return []Rule{r.rule}
+	case *InEveryKeyGroupRule:
+		return []Rule{r.rule}
+	case *InAnyKeyGroupRule:
+		return []Rule{r.rule}
+	default:
+		return nil
+	}
+}
+
 // metaRule is used by all available rules as their implementation of
 // Rule.Meta() and Rule.SetMeta() to reduce boilerplate.
 type metaRule struct {
@@ -63,8 +164,19 @@ func (r *metaRule) SetMeta(meta Meta) {
 var (
 	_ Rule = &AllOfRule{}
 	_ Rule = &AnyOfRule{}
+	_ Rule = &InAnyKeyGroupRule{}
+	_ Rule = &InEveryKeyGroupRule{}
+	_ Rule = &KeyGroupsRule{}
 	_ Rule = &MatchRule{}
+	_ Rule = &MatchKMSRule{}
 	_ Rule = &MatchRegexRule{}
+	_ Rule = &MatchTypeRule{}
+	_ Rule = &MaxKeyAgeRule{}
+	_ Rule = &MaxLastModifiedAgeRule{}
+	_ Rule = &MetadataRule{}
+	_ Rule = &NOfRule{}
 	_ Rule = &NotRule{}
 	_ Rule = &OneOfRule{}
+	_ Rule = &RefRule{}
+	_ Rule = &ShamirThresholdRule{}
 )
@@ -1,15 +1,19 @@
 package rules_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Bonial-International-GmbH/sops-check/internal/config"
 	"github.com/Bonial-International-GmbH/sops-check/internal/rules"
+	"github.com/Bonial-International-GmbH/sops-check/internal/sops"
+	gosops "github.com/getsops/sops/v3"
 	"github.com/goccy/go-yaml"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -22,10 +26,74 @@ type testConfig struct {
 }
 
 type testCase struct {
-	Description    string   `json:"description"`
-	TrustAnchors   []string `json:"trustAnchors"`
-	ExpectSuccess  bool     `json:"expectSuccess"`
-	ExpectedOutput string   `json:"expectedOutput"`
+	Description  string     `json:"description"`
+	TrustAnchors []string   `json:"trustAnchors"`
+	KeyGroups    [][]string `json:"keyGroups"`
+	// CreatedAt maps trust anchors to their creation time.
+	CreatedAt      map[string]time.Time `json:"createdAt"`
+	FilePath       string               `json:"filePath"`
+	Metadata       *testMetadata        `json:"metadata"`
+	Now            time.Time            `json:"now"`
+	ExpectSuccess  bool                 `json:"expectSuccess"`
+	ExpectedOutput string               `json:"expectedOutput"`
+}
+
+// testMetadata mirrors the SOPS metadata fields as they appear in SOPS files.
+type testMetadata struct {
+	EncryptedRegex          string    `json:"encrypted_regex"`
+	EncryptedSuffix         string    `json:"encrypted_suffix"`
+	UnencryptedRegex        string    `json:"unencrypted_regex"`
+	UnencryptedSuffix       string    `json:"unencrypted_suffix"`
+	EncryptedCommentRegex   string    `json:"encrypted_comment_regex"`
+	UnencryptedCommentRegex string    `json:"unencrypted_comment_regex"`
+	MACOnlyEncrypted        bool      `json:"mac_only_encrypted"`
+	Version                 string    `json:"version"`
+	ShamirThreshold         int       `json:"shamir_threshold"`
+	LastModified            time.Time `json:"lastmodified"`
+}
+
+func (m *testMetadata) toSOPS() *gosops.Metadata {
+	if m == nil {
+		return nil
+	}
+
+	return &gosops.Metadata{
+		EncryptedRegex:          m.EncryptedRegex,
+		EncryptedSuffix:         m.EncryptedSuffix,
+		UnencryptedRegex:        m.UnencryptedRegex,
+		UnencryptedSuffix:       m.UnencryptedSuffix,
+		EncryptedCommentRegex:   m.EncryptedCommentRegex,
+		UnencryptedCommentRegex: m.UnencryptedCommentRegex,
+		MACOnlyEncrypted:        m.MACOnlyEncrypted,
+		Version:                 m.Version,
+		ShamirThreshold:         m.ShamirThreshold,
+		LastModified:            m.LastModified,
+	}
+}
+
+// evalContext creates the EvalContext for the test case. If key groups are
+// defined, they take precedence over trust anchors.
+func (c *testCase) evalContext() *rules.EvalContext {
+	keyGroups := c.KeyGroups
+	if keyGroups == nil && len(c.TrustAnchors) > 0 {
+		keyGroups = [][]string{c.TrustAnchors}
+	}
+
+	anchors := make([][]sops.TrustAnchor, len(keyGroups))
+	for i, keyGroup := range keyGroups {
+		for _, trustAnchor := range keyGroup {
+			anchor := sops.ParseTrustAnchor(trustAnchor)
+			anchor.CreatedAt = c.CreatedAt[trustAnchor]
+			anchors[i] = append(anchors[i], anchor)
+		}
+	}
+
+	ctx := rules.NewEvalContextFromKeyGroups(anchors)
+	ctx.FilePath = c.FilePath
+	ctx.Metadata = c.Metadata.toSOPS()
+	ctx.Now = c.Now
+
+	return ctx
 }
 
 func loadTestConfig(filePath string) (*testConfig, error) {
@@ -48,6 +116,87 @@ func loadTestConfig(filePath string) (*testConfig, error) {
 	return &test, nil
 }
 
+// TestCompileErrors asserts that invalid configurations are rejected during
+// rule compilation.
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		expectedErr string
+	}{
+		{
+			name: "unknown reference",
+			config: `
+rules:
+  - ref: nonexistent`,
+			expectedErr: `reference to unknown rule definition "nonexistent"`,
+		},
+		{
+			name: "cyclic reference",
+			config: `
+definitions:
+  foo:
+    anyOf:
+      - match: foo
+      - ref: bar
+  bar:
+    not:
+      ref: foo
+rules:
+  - match: baz`,
+			expectedErr: "cyclic reference to rule definition: bar -> foo -> bar",
+		},
+		{
+			name: "self reference",
+			config: `
+definitions:
+  foo:
+    ref: foo
+rules:
+  - ref: foo`,
+			expectedErr: "cyclic reference to rule definition: foo -> foo",
+		},
+		{
+			name: "invalid definition",
+			config: `
+definitions:
+  foo:
+    matchRegex: "("
+rules:
+  - match: foo`,
+			expectedErr: `invalid rule definition "foo"`,
+		},
+		{
+			name: "invalid minimum version",
+			config: `
+rules:
+  - metadata:
+      minVersion: latest`,
+			expectedErr: `invalid minimum version "latest"`,
+		},
+		{
+			name: "duplicate id",
+			config: `
+rules:
+  - match: foo
+    id: team
+  - match: bar
+    id: team`,
+			expectedErr: `duplicate rule id "team"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.LoadReader(strings.NewReader(tt.config))
+			require.NoError(t, err)
+
+			_, err = rules.Compile(cfg)
+			require.ErrorContains(t, err, tt.expectedErr)
+		})
+	}
+}
+
 // TestUI finds and runs all UI tests defined in the testdata/ui/ directory.
 //
 // It asserts that:
@@ -71,7 +220,7 @@ func TestUI(t *testing.T) {
 		require.NoError(t, err)
 
 		// Compile rules.
-		rootRule, err := rules.Compile(cfg.Rules)
+		rootRule, err := rules.Compile(cfg)
 		require.NoError(t, err)
 
 		// Run test cases.
@@ -79,7 +228,7 @@ func TestUI(t *testing.T) {
 			name := fmt.Sprintf("%s-%d", filepath.Base(path), i)
 
 			t.Run(name, func(t *testing.T) {
-				ctx := rules.NewEvalContext(testCase.TrustAnchors)
+				ctx := testCase.evalContext()
 				result := rootRule.Eval(ctx)
 
 				assert.Equal(t, testCase.ExpectSuccess, result.Success)
@@ -88,3 +237,271 @@ func TestUI(t *testing.T) {
 		}
 	}
 }
+
+// TestSarifResults asserts that one result is created for every failed leaf
+// rule and unmatched trust anchor, pointing at the entries of offending trust
+// anchors, or at the SOPS metadata if something is missing from it.
+func TestSarifResults(t *testing.T) {
+	locations := &sops.Locations{
+		Metadata: sops.Region{Line: 2, Column: 1},
+		TrustAnchors: map[string][]sops.Region{
+			"age1good":  {{Line: 4, Column: 11}},
+			"age1bad":   {{Line: 6, Column: 11}, {Line: 12, Column: 11}},
+			"age1extra": {{Line: 8, Column: 11}},
+		},
+	}
+
+	type expectedResult struct {
+		ruleID     string
+		evaluation string
+		regions    []sops.Region
+	}
+
+	tests := []struct {
+		name           string
+		config         string
+		allowUnmatched bool
+		expected       []expectedResult
+	}{
+		{
+			name: "success",
+			config: `
+rules:
+  - match: age1good`,
+			allowUnmatched: true,
+			expected:       []expectedResult{},
+		},
+		{
+			name: "unmatched",
+			config: `
+rules:
+  - anyOf:
+      - match: age1good
+      - match: age1bad`,
+			expected: []expectedResult{
+				{ruleID: rules.UnmatchedRuleID, evaluation: "error", regions: []sops.Region{{Line: 8, Column: 11}}},
+			},
+		},
+		{
+			name: "missing trust anchors",
+			config: `
+rules:
+  - match: age1missing
+    id: missing
+    url: https://example.com/missing
+  - allOf:
+      - match: age1good
+      - match: age1other`,
+			allowUnmatched: true,
+			expected: []expectedResult{
+				{ruleID: "missing", evaluation: "error", regions: []sops.Region{{Line: 2, Column: 1}}},
+				{ruleID: "rules[1].allOf[1]", evaluation: "error", regions: []sops.Region{{Line: 2, Column: 1}}},
+			},
+		},
+		{
+			name: "forbidden trust anchor",
+			config: `
+definitions:
+  forbidden:
+    match: age1bad
+rules:
+  - not:
+      ref: forbidden`,
+			allowUnmatched: true,
+			expected: []expectedResult{
+				{ruleID: "rules[0]", evaluation: "error", regions: []sops.Region{{Line: 6, Column: 11}, {Line: 12, Column: 11}}},
+			},
+		},
+		{
+			name: "warning",
+			config: `
+rules:
+  - allOf:
+      - match: age1good
+      - not:
+          match: age1extra
+        severity: warning
+      - anyOf:
+          - match: age1missing
+          - match: age1other
+        severity: note`,
+			allowUnmatched: true,
+			expected: []expectedResult{
+				{ruleID: "rules[0].allOf[1]", evaluation: "warning", regions: []sops.Region{{Line: 8, Column: 11}}},
+				{ruleID: "rules[0].allOf[2].anyOf[0]", evaluation: "note", regions: []sops.Region{{Line: 2, Column: 1}}},
+				{ruleID: "rules[0].allOf[2].anyOf[1]", evaluation: "note", regions: []sops.Region{{Line: 2, Column: 1}}},
+			},
+		},
+	}
+
+	ctx := rules.NewEvalContext([]string{"age1good", "age1bad", "age1extra"})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.LoadReader(strings.NewReader(tt.config))
+			require.NoError(t, err)
+
+			rootRule, err := rules.Compile(cfg)
+			require.NoError(t, err)
+
+			result := rootRule.Eval(ctx)
+
+			actual := []expectedResult{}
+			for _, sarifResult := range result.SarifResults("secret.yaml", locations, tt.allowUnmatched) {
+				assert.Equal(t, "secret.yaml", sarifResult.File)
+				actual = append(actual, expectedResult{sarifResult.RuleID, sarifResult.Evaluation, sarifResult.Regions})
+			}
+
+			assert.Equal(t, tt.expected, actual)
+
+			for _, sarifResult := range result.SarifResults("secret.yaml", nil, tt.allowUnmatched) {
+				assert.Nil(t, sarifResult.Regions)
+			}
+		})
+	}
+}
+
+// TestRuleIDs asserts that rules are identified by their explicit ID or by
+// their path within the configuration.
+func TestRuleIDs(t *testing.T) {
+	cfg, err := config.LoadReader(strings.NewReader(`
+definitions:
+  team:
+    anyOf:
+      - match: age1first
+        id: first
+      - match: age1second
+        url: https://example.com/second
+rules:
+  - ref: team
+  - inEveryKeyGroup:
+      not:
+        matchType: pgp
+  - atLeast: 1
+    rules:
+      - ref: team`))
+	require.NoError(t, err)
+
+	rootRule, err := rules.Compile(cfg)
+	require.NoError(t, err)
+
+	var ids []string
+
+	rules.Walk(rootRule, func(rule rules.Rule) {
+		ids = append(ids, rule.Meta().ID)
+	})
+
+	assert.Equal(t, []string{
+		"",
+		"rules[0]",
+		"definitions.team",
+		"first",
+		"definitions.team.anyOf[1]",
+		"rules[1]",
+		"rules[1].inEveryKeyGroup",
+		"rules[1].inEveryKeyGroup.not",
+		"rules[2]",
+		"rules[2].rules[0]",
+	}, ids)
+}
+
+// TestMarshalJSON asserts that results are marshaled along with their rules,
+// and that trust anchors are sorted.
+func TestMarshalJSON(t *testing.T) {
+	cfg, err := config.LoadReader(strings.NewReader(`
+rules:
+  - id: team
+    description: Team keys must be present.
+    url: https://example.com/team
+    paths:
+      - envs/
+    atLeast: 1
+    rules:
+      - matchRegex: ^age1
+      - keyGroups:
+          min: 1
+  - not:
+      metadata:
+        macOnlyEncrypted: true
+    severity: warning`))
+	require.NoError(t, err)
+
+	rootRule, err := rules.Compile(cfg)
+	require.NoError(t, err)
+
+	ctx := rules.NewEvalContext([]string{"age1second", "age1first"})
+	ctx.FilePath = "envs/secret.yaml"
+
+	result := rootRule.Eval(ctx)
+
+	data, err := json.Marshal(&result)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+  "rule": {"kind": "allOf"},
+  "success": true,
+  "matched": ["age1first", "age1second"],
+  "unmatched": [],
+  "nested": [
+    {
+      "rule": {
+        "kind": "nOf",
+        "id": "team",
+        "description": "Team keys must be present.",
+        "url": "https://example.com/team",
+        "paths": ["envs/"],
+        "atLeast": 1,
+        "atMost": 2
+      },
+      "success": true,
+      "matched": ["age1first", "age1second"],
+      "unmatched": [],
+      "nested": [
+        {
+          "rule": {"kind": "matchRegex", "id": "rules[0].rules[0]", "pattern": "^age1"},
+          "success": true,
+          "matched": ["age1first", "age1second"],
+          "unmatched": []
+        },
+        {
+          "rule": {"kind": "keyGroups", "id": "rules[0].rules[1]", "min": 1},
+          "success": true,
+          "matched": [],
+          "unmatched": ["age1first", "age1second"]
+        }
+      ]
+    },
+    {
+      "rule": {"kind": "not", "id": "rules[1]", "severity": "warning"},
+      "success": true,
+      "matched": ["age1first", "age1second"],
+      "unmatched": [],
+      "nested": [
+        {
+          "rule": {"kind": "metadata", "id": "rules[1].not", "checks": ["mac_only_encrypted is true"]},
+          "success": false,
+          "matched": [],
+          "unmatched": ["age1first", "age1second"],
+          "violations": ["mac_only_encrypted must be true, but it is false"]
+        }
+      ]
+    }
+  ]
+}`, string(data))
+}
+
+func TestScope(t *testing.T) {
+	scope := rules.NewScope([]string{"envs/production/**"}, []string{"envs/production/legacy/"})
+
+	for path, expected := range map[string]bool{
+		"envs/production/secret.yaml":        true,
+		"./envs/production/app/secret.yaml":  true,
+		"other/envs/production/secret.yaml":  false,
+		"envs/production/legacy/secret.yaml": false,
+		"envs/staging/secret.yaml":           false,
+	} {
+		assert.Equal(t, expected, scope.Matches(path), path)
+	}
+
+	assert.Nil(t, rules.NewScope(nil, nil))
+}
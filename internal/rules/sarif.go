@@ -0,0 +1,178 @@
+package rules
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/Bonial-International-GmbH/sops-check/internal/sops"
+)
+
+// UnmatchedRuleID is the rule ID of SARIF results for trust anchors which are
+// not matched by any rule.
+const UnmatchedRuleID = "unmatchedTrustAnchor"
+
+// SarifResults converts the evaluation result into SARIF results for the file
+// at filepath: one for every failed leaf rule, e.g. a missing trust anchor,
+// and one for every unmatched trust anchor unless allowUnmatched is set. Soft
+// failures are reported with the severity of their rule. If locations is not
+// nil, the results point at the offending parts of the file.
+func (r *EvalResult) SarifResults(filepath string, locations *sops.Locations, allowUnmatched bool) []SarifResult {
+	var violations []violation
+
+	if !r.Success {
+		violations = collectViolations(violations, r, SeverityError)
+	}
+
+	for i := range r.Warnings {
+		violations = collectViolations(violations, &r.Warnings[i], SeverityWarning)
+	}
+
+	results := make([]SarifResult, 0, len(violations))
+
+	for _, v := range violations {
+		meta := v.result.Rule.Meta()
+
+		id := meta.ID
+		if id == "" {
+			id = string(v.result.Rule.Kind())
+		}
+
+		var buf formatBuffer
+		formatFailure(&buf, v.result)
+
+		results = append(results, SarifResult{
+			RuleID:      id,
+			Evaluation:  string(v.severity),
+			Kind:        "fail",
+			Message:     buf.String(),
+			Description: meta.Description,
+			HelpURI:     meta.URL,
+			File:        filepath,
+			Regions:     regions(locations, v.trustAnchors),
+		})
+	}
+
+	if allowUnmatched || r.Unmatched == nil {
+		return results
+	}
+
+	unmatched := r.Unmatched.Slice()
+	sort.Strings(unmatched)
+
+	for _, trustAnchor := range unmatched {
+		results = append(results, SarifResult{
+			RuleID:      UnmatchedRuleID,
+			Evaluation:  string(SeverityError),
+			Kind:        "fail",
+			Message:     fmt.Sprintf("Trust anchor %q was not matched by any rule.", trustAnchor),
+			Description: "Trust anchors must be matched by at least one rule",
+			File:        filepath,
+			Regions:     regions(locations, []string{trustAnchor}),
+		})
+	}
+
+	return results
+}
+
+// violation is a failed leaf rule within an evaluation result.
+type violation struct {
+	result   *EvalResult
+	severity Severity
+	// trustAnchors contains the trust anchors which caused the failure,
+	// e.g. ones matched by a rule that was expected to fail. If empty, the
+	// failure is caused by the SOPS metadata as a whole, e.g. because an
+	// expected trust anchor is missing.
+	trustAnchors []string
+}
+
+// collectViolations appends the failed leaf rules of a failed result to
+// violations, mirroring the traversal of formatFailure. Rules without an
+// explicit severity inherit the given one.
+func collectViolations(violations []violation, result *EvalResult, severity Severity) []violation {
+	if s := result.Rule.Meta().Severity; s != "" {
+		severity = s
+	}
+
+	result = result.flatten()
+
+	if s := result.Rule.Meta().Severity; s != "" {
+		severity = s
+	}
+
+	successes, failures := result.partitionNested()
+
+	switch r := result.Rule.(type) {
+	case *InEveryKeyGroupRule, *InAnyKeyGroupRule:
+		_, failures = keyGroupFailures(result)
+	case *AllOfRule, *AnyOfRule, *RefRule:
+		// The violations are found in the failed nested rules.
+	case *NotRule:
+		return append(violations, violation{result, severity, matchedTrustAnchors(successes)})
+	case *OneOfRule:
+		if len(successes) > 0 {
+			return append(violations, violation{result, severity, matchedTrustAnchors(successes)})
+		}
+	case *NOfRule:
+		if len(successes) >= r.atLeast {
+			return append(violations, violation{result, severity, matchedTrustAnchors(successes)})
+		}
+	default:
+		failures = nil
+	}
+
+	// Compound rules without failed nested rules, e.g. because there are no
+	// key groups, are violations on their own.
+	if len(failures) == 0 {
+		return append(violations, violation{result: result, severity: severity})
+	}
+
+	for i := range failures {
+		violations = collectViolations(violations, &failures[i], severity)
+	}
+
+	return violations
+}
+
+// matchedTrustAnchors returns the sorted trust anchors matched by results which
+// were expected to fail.
+func matchedTrustAnchors(results []EvalResult) []string {
+	matched := emptyStringSet()
+
+	for _, result := range results {
+		if result.Matched != nil {
+			matched.InsertSet(result.Matched)
+		}
+	}
+
+	trustAnchors := matched.Slice()
+	sort.Strings(trustAnchors)
+
+	return trustAnchors
+}
+
+// regions returns the positions of the entries of trustAnchors within a file.
+// The position of the SOPS metadata is used if there are no trust anchors or
+// if they cannot be located. Returns nil if locations is nil.
+func regions(locations *sops.Locations, trustAnchors []string) []sops.Region {
+	if locations == nil {
+		return nil
+	}
+
+	var regions []sops.Region
+
+	for _, trustAnchor := range trustAnchors {
+		regions = append(regions, locations.TrustAnchors[trustAnchor]...)
+	}
+
+	if len(regions) == 0 {
+		return []sops.Region{locations.Metadata}
+	}
+
+	slices.SortFunc(regions, func(a, b sops.Region) int {
+		return cmp.Or(cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column))
+	})
+
+	return slices.Compact(regions)
+}
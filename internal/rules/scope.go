@@ -0,0 +1,73 @@
+package rules
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/Bonial-International-GmbH/sops-check/internal/ignore"
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// Scope restricts the evaluation of a rule to files whose path matches a set
+// of gitignore-style patterns.
+type Scope struct {
+	paths        []string
+	excludePaths []string
+	include      *gitignore.GitIgnore
+	exclude      *gitignore.GitIgnore
+}
+
+// NewScope creates a Scope which matches all files matching any of paths, but
+// none of excludePaths. An empty list of paths matches all files. Returns nil
+// if both lists are empty.
+func NewScope(paths, excludePaths []string) *Scope {
+	if len(paths) == 0 && len(excludePaths) == 0 {
+		return nil
+	}
+
+	return &Scope{
+		paths:        paths,
+		excludePaths: excludePaths,
+		include:      ignore.CompilePatterns(paths...),
+		exclude:      ignore.CompilePatterns(excludePaths...),
+	}
+}
+
+// Matches returns true if path is within the scope. A nil scope matches all
+// paths.
+func (s *Scope) Matches(path string) bool {
+	if s == nil {
+		return true
+	}
+
+	path = filepath.ToSlash(filepath.Clean(path))
+
+	if len(s.paths) > 0 && !s.include.MatchesPath(path) {
+		return false
+	}
+
+	return !s.exclude.MatchesPath(path)
+}
+
+// String returns a human readable representation of the scope.
+func (s *Scope) String() string {
+	if s == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	if len(s.paths) > 0 {
+		sb.WriteString(strings.Join(s.paths, ", "))
+	} else {
+		sb.WriteString("all paths")
+	}
+
+	if len(s.excludePaths) > 0 {
+		sb.WriteString(" (excluding ")
+		sb.WriteString(strings.Join(s.excludePaths, ", "))
+		sb.WriteString(")")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,55 @@
+package rules
+
+import "fmt"
+
+// ShamirThresholdRule asserts that the number of key groups required to
+// decrypt a file lies within a user-defined range. It does not match any trust
+// anchors.
+type ShamirThresholdRule struct {
+	metaRule
+	threshold countRange
+}
+
+// ShamirThreshold creates a ShamirThresholdRule which asserts that the Shamir
+// threshold of a file is at least min and at most max. A negative max means
+// that there is no upper bound.
+//
+// If a file has no explicit threshold, SOPS requires all of its key groups to
+// decrypt it, so the number of key groups is used as the threshold.
+func ShamirThreshold(min, max int) *ShamirThresholdRule {
+	return &ShamirThresholdRule{threshold: countRange{min: min, max: max}}
+}
+
+// Kind implements Rule.
+func (*ShamirThresholdRule) Kind() Kind {
+	return KindShamirThreshold
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r *ShamirThresholdRule) MarshalJSON() ([]byte, error) {
+	return marshalRule(r, rangeJSON(r.threshold))
+}
+
+// Eval implements Rule.
+func (r *ShamirThresholdRule) Eval(ctx *EvalContext) EvalResult {
+	var violations []string
+
+	if n := ctx.shamirThreshold(); !r.threshold.contains(n) {
+		violations = append(violations, fmt.Sprintf("Expected Shamir threshold of %s, but found %d.", r.threshold, n))
+	}
+
+	matched := emptyStringSet()
+
+	return EvalResult{
+		Rule:       r,
+		Success:    len(violations) == 0,
+		Matched:    matched,
+		Unmatched:  ctx.TrustAnchors.Difference(matched),
+		Violations: violations,
+	}
+}
+
+// String returns a human readable description of the requirement.
+func (r *ShamirThresholdRule) String() string {
+	return fmt.Sprintf("Shamir threshold is %s.", r.threshold)
+}
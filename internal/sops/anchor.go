@@ -0,0 +1,199 @@
+package sops
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/getsops/sops/v3/keys"
+)
+
+// KeyType is the type of a trust anchor, as used by SOPS to identify the
+// different kinds of master keys.
+type KeyType string
+
+const (
+	// KeyTypeKMS identifies AWS KMS keys.
+	KeyTypeKMS KeyType = "kms"
+	// KeyTypeGCPKMS identifies GCP KMS keys.
+	KeyTypeGCPKMS KeyType = "gcp_kms"
+	// KeyTypeAzureKV identifies Azure Key Vault keys.
+	KeyTypeAzureKV KeyType = "azure_kv"
+	// KeyTypeHCVault identifies HashiCorp Vault transit keys.
+	KeyTypeHCVault KeyType = "hc_vault"
+	// KeyTypeAge identifies age recipients.
+	KeyTypeAge KeyType = "age"
+	// KeyTypePGP identifies PGP keys.
+	KeyTypePGP KeyType = "pgp"
+	// KeyTypeUnknown is used for trust anchors whose type cannot be
+	// determined.
+	KeyTypeUnknown KeyType = "unknown"
+)
+
+// KeyTypes contains all known key types.
+var KeyTypes = []KeyType{
+	KeyTypeKMS,
+	KeyTypeGCPKMS,
+	KeyTypeAzureKV,
+	KeyTypeHCVault,
+	KeyTypeAge,
+	KeyTypePGP,
+}
+
+// Fields of trust anchors, depending on their type.
+const (
+	// FieldARN is the ARN of an AWS KMS key.
+	FieldARN = "arn"
+	// FieldPartition is the AWS partition of an AWS KMS key.
+	FieldPartition = "partition"
+	// FieldRegion is the AWS region of an AWS KMS key.
+	FieldRegion = "region"
+	// FieldAccount is the AWS account ID of an AWS KMS key.
+	FieldAccount = "account"
+	// FieldAlias is the alias name of an AWS KMS key, if it is referenced by
+	// alias.
+	FieldAlias = "alias"
+	// FieldKeyID is the key ID of an AWS KMS key, if it is referenced by ID.
+	FieldKeyID = "key"
+	// FieldRole is the IAM role assumed to access an AWS KMS key.
+	FieldRole = "role"
+	// FieldProject is the project of a GCP KMS key.
+	FieldProject = "project"
+	// FieldLocation is the location of a GCP KMS key.
+	FieldLocation = "location"
+	// FieldKeyRing is the key ring of a GCP KMS key.
+	FieldKeyRing = "keyRing"
+	// FieldVaultAddress is the address of an Azure Key Vault or a HashiCorp
+	// Vault server.
+	FieldVaultAddress = "vaultAddress"
+	// FieldKeyName is the name of an Azure Key Vault, GCP KMS or HashiCorp
+	// Vault key.
+	FieldKeyName = "keyName"
+	// FieldKeyVersion is the version of an Azure Key Vault key.
+	FieldKeyVersion = "keyVersion"
+	// FieldEnginePath is the path of the HashiCorp Vault transit engine.
+	FieldEnginePath = "enginePath"
+)
+
+var (
+	kmsARNRegex      = regexp.MustCompile(`^arn:(aws[\w-]*):kms:([^:]+):([0-9]+):(key|alias)/(.+)$`)
+	gcpKMSRegex      = regexp.MustCompile(`^projects/([^/]+)/locations/([^/]+)/keyRings/([^/]+)/cryptoKeys/([^/]+)$`)
+	azureKVRegex     = regexp.MustCompile(`^(https://[^/]+)/keys/([^/]+)/([^/]*)$`)
+	hcVaultRegex     = regexp.MustCompile(`^(https?://[^/]+)/v1/(.+)/keys/([^/]+)$`)
+	pgpFingerprintRe = regexp.MustCompile(`^[0-9A-Fa-f]{40}$`)
+)
+
+// TrustAnchor is the structured representation of a SOPS master key.
+type TrustAnchor struct {
+	// ID is the identifier of the trust anchor as rendered by SOPS. This is
+	// what rules match against.
+	ID string
+	// Type is the type of the trust anchor.
+	Type KeyType
+	// Fields contains fields parsed from the identifier. The available fields
+	// depend on the type of the trust anchor.
+	Fields map[string]string
+	// CreatedAt is the time at which the data key was encrypted with the
+	// trust anchor. It is zero if unknown, e.g. for age recipients, which do
+	// not record a creation time.
+	CreatedAt time.Time
+}
+
+// NewTrustAnchor creates a TrustAnchor from a SOPS master key.
+func NewTrustAnchor(key keys.MasterKey) TrustAnchor {
+	anchor := newTrustAnchor(KeyType(key.TypeToIdentifier()), key.ToString())
+
+	if createdAt, ok := key.ToMap()["created_at"].(string); ok {
+		anchor.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	}
+
+	return anchor
+}
+
+// ParseTrustAnchor creates a TrustAnchor from its identifier, inferring the
+// type from the format of the identifier.
+func ParseTrustAnchor(id string) TrustAnchor {
+	return newTrustAnchor(inferKeyType(id), id)
+}
+
+func newTrustAnchor(keyType KeyType, id string) TrustAnchor {
+	fields := make(map[string]string)
+
+	switch keyType {
+	case KeyTypeKMS:
+		parseKMSFields(id, fields)
+	case KeyTypeGCPKMS:
+		if m := gcpKMSRegex.FindStringSubmatch(id); m != nil {
+			fields[FieldProject] = m[1]
+			fields[FieldLocation] = m[2]
+			fields[FieldKeyRing] = m[3]
+			fields[FieldKeyName] = m[4]
+		}
+	case KeyTypeAzureKV:
+		if m := azureKVRegex.FindStringSubmatch(id); m != nil {
+			fields[FieldVaultAddress] = m[1]
+			fields[FieldKeyName] = m[2]
+			fields[FieldKeyVersion] = m[3]
+		}
+	case KeyTypeHCVault:
+		if m := hcVaultRegex.FindStringSubmatch(id); m != nil {
+			fields[FieldVaultAddress] = m[1]
+			fields[FieldEnginePath] = m[2]
+			fields[FieldKeyName] = m[3]
+		}
+	}
+
+	return TrustAnchor{ID: id, Type: keyType, Fields: fields}
+}
+
+// parseKMSFields parses the fields of an AWS KMS trust anchor. The identifier
+// has the format `<arn>[+<role>][|<encryption context>][|<aws profile>]`.
+func parseKMSFields(id string, fields map[string]string) {
+	arnRole, _, _ := strings.Cut(id, "|")
+	arn, role, _ := strings.Cut(arnRole, "+")
+
+	fields[FieldARN] = arn
+
+	if role != "" {
+		fields[FieldRole] = role
+	}
+
+	m := kmsARNRegex.FindStringSubmatch(arn)
+	if m == nil {
+		return
+	}
+
+	fields[FieldPartition] = m[1]
+	fields[FieldRegion] = m[2]
+	fields[FieldAccount] = m[3]
+
+	if m[4] == "alias" {
+		fields[FieldAlias] = m[5]
+	} else {
+		fields[FieldKeyID] = m[5]
+	}
+}
+
+// inferKeyType infers the key type from the format of a trust anchor
+// identifier.
+func inferKeyType(id string) KeyType {
+	switch {
+	case strings.HasPrefix(id, "arn:"):
+		return KeyTypeKMS
+	case strings.HasPrefix(id, "age1"):
+		return KeyTypeAge
+	case gcpKMSRegex.MatchString(id):
+		return KeyTypeGCPKMS
+	case pgpFingerprintRe.MatchString(id):
+		return KeyTypePGP
+	case hcVaultRegex.MatchString(id):
+		return KeyTypeHCVault
+	case azureKVRegex.MatchString(id):
+		if u, err := url.Parse(id); err == nil && strings.Contains(u.Host, ".vault.") {
+			return KeyTypeAzureKV
+		}
+	}
+
+	return KeyTypeUnknown
+}
@@ -0,0 +1,188 @@
+package sops
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	gosops "github.com/getsops/sops/v3"
+	sopsconfig "github.com/getsops/sops/v3/config"
+)
+
+// CreationRule is a creation rule of a .sops.yaml file.
+type CreationRule struct {
+	// ConfigPath is the path of the .sops.yaml file containing the rule.
+	ConfigPath string
+	// Index is the position of the rule in the creation_rules list. It is
+	// only set for rules loaded via LoadCreationRules.
+	Index int
+	// PathRegex is the path_regex of the rule. It is only set for rules
+	// loaded via LoadCreationRules.
+	PathRegex string
+	// KeyGroups contains the trust anchors of each key group that SOPS would
+	// use when encrypting the file.
+	KeyGroups [][]TrustAnchor
+	// ShamirThreshold is the Shamir threshold configured by the rule. It is
+	// zero if the rule does not configure a threshold.
+	ShamirThreshold int
+
+	metadata gosops.Metadata
+}
+
+// FindCreationRule locates the nearest .sops.yaml file for the file at
+// filePath and resolves the creation rule which applies to it, using the same
+// lookup and path_regex semantics as SOPS itself. Returns nil if there is no
+// .sops.yaml file or if none of its creation rules match the file.
+func FindCreationRule(filePath string) (*CreationRule, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	configPath, err := sopsconfig.FindConfigFile(absPath)
+	if err != nil {
+		// SOPS does not distinguish between a missing config file and
+		// other lookup errors.
+		return nil, nil
+	}
+
+	creationRules, err := LoadCreationRules(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve creation rule from %s: %w", configPath, err)
+	}
+
+	return matchCreationRule(creationRules, absPath)
+}
+
+// matchCreationRule returns the first of the creation rules of a single
+// .sops.yaml file whose path_regex matches the file at absPath, relative to the
+// directory of the .sops.yaml file, like SOPS does. Rules without path_regex
+// match all files. Returns nil if no rule matches.
+func matchCreationRule(creationRules []CreationRule, absPath string) (*CreationRule, error) {
+	for i := range creationRules {
+		rule := &creationRules[i]
+
+		if rule.PathRegex == "" {
+			return rule, nil
+		}
+
+		configDir, err := filepath.Abs(filepath.Dir(rule.ConfigPath))
+		if err != nil {
+			return nil, err
+		}
+
+		pattern, err := regexp.Compile(rule.PathRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path_regex of %s in %s: %w", rule.String(), rule.ConfigPath, err)
+		}
+
+		if pattern.MatchString(strings.TrimPrefix(absPath, configDir+string(filepath.Separator))) {
+			return rule, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// newCreationRule creates a CreationRule from the configuration that SOPS
+// would use for files matching it.
+func newCreationRule(configPath string, config *sopsconfig.Config) *CreationRule {
+	rule := &CreationRule{
+		ConfigPath:      configPath,
+		KeyGroups:       make([][]TrustAnchor, len(config.KeyGroups)),
+		ShamirThreshold: config.ShamirThreshold,
+		metadata: gosops.Metadata{
+			ShamirThreshold:         config.ShamirThreshold,
+			UnencryptedSuffix:       config.UnencryptedSuffix,
+			EncryptedSuffix:         config.EncryptedSuffix,
+			UnencryptedRegex:        config.UnencryptedRegex,
+			EncryptedRegex:          config.EncryptedRegex,
+			UnencryptedCommentRegex: config.UnencryptedCommentRegex,
+			EncryptedCommentRegex:   config.EncryptedCommentRegex,
+			MACOnlyEncrypted:        config.MACOnlyEncrypted,
+		},
+	}
+
+	for i, keyGroup := range config.KeyGroups {
+		for _, key := range keyGroup {
+			rule.KeyGroups[i] = append(rule.KeyGroups[i], NewTrustAnchor(key))
+		}
+	}
+
+	return rule
+}
+
+// CreationRuleDrift compares the key groups of f with those of rule and
+// returns human readable descriptions of the differences, i.e. of the changes
+// `sops updatekeys` would make. Returns nil if there are no differences.
+func (f *File) CreationRuleDrift(rule *CreationRule) []string {
+	var drift []string
+
+	actual := f.KeyGroups()
+
+	if len(actual) != len(rule.KeyGroups) {
+		drift = append(drift, fmt.Sprintf("Expected %d key groups, but found %d.", len(rule.KeyGroups), len(actual)))
+	}
+
+	for i := range max(len(actual), len(rule.KeyGroups)) {
+		actualIDs := trustAnchorIDs(actual, i)
+		expectedIDs := trustAnchorIDs(rule.KeyGroups, i)
+
+		if missing := difference(expectedIDs, actualIDs); len(missing) > 0 {
+			drift = append(drift, fmt.Sprintf("Key group %d is missing trust anchors: %s", i+1, strings.Join(missing, ", ")))
+		}
+
+		if unexpected := difference(actualIDs, expectedIDs); len(unexpected) > 0 {
+			drift = append(drift, fmt.Sprintf("Key group %d has unexpected trust anchors: %s", i+1, strings.Join(unexpected, ", ")))
+		}
+	}
+
+	// SOPS requires all key groups for decryption if no threshold is set.
+	expectedThreshold := effectiveThreshold(rule.ShamirThreshold, len(rule.KeyGroups))
+	actualThreshold := effectiveThreshold(f.Metadata.ShamirThreshold, len(actual))
+
+	if expectedThreshold != actualThreshold {
+		drift = append(drift, fmt.Sprintf("Expected Shamir threshold of %d, but found %d.", expectedThreshold, actualThreshold))
+	}
+
+	return drift
+}
+
+// trustAnchorIDs returns the set of trust anchor identifiers of the key group
+// at index i, which is empty if there is no such key group.
+func trustAnchorIDs(keyGroups [][]TrustAnchor, i int) map[string]struct{} {
+	ids := make(map[string]struct{})
+
+	if i < len(keyGroups) {
+		for _, anchor := range keyGroups[i] {
+			ids[anchor.ID] = struct{}{}
+		}
+	}
+
+	return ids
+}
+
+// difference returns the sorted identifiers in a that are not in b.
+func difference(a, b map[string]struct{}) []string {
+	var diff []string
+
+	for id := range a {
+		if _, ok := b[id]; !ok {
+			diff = append(diff, id)
+		}
+	}
+
+	sort.Strings(diff)
+
+	return diff
+}
+
+func effectiveThreshold(threshold, keyGroups int) int {
+	if threshold > 0 {
+		return threshold
+	}
+
+	return keyGroups
+}
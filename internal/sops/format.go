@@ -0,0 +1,205 @@
+package sops
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Bonial-International-GmbH/sops-check/internal/ignore"
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/stores/dotenv"
+	"github.com/getsops/sops/v3/stores/ini"
+	"github.com/getsops/sops/v3/stores/json"
+	"github.com/getsops/sops/v3/stores/yaml"
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// Format is a file format supported by SOPS.
+type Format string
+
+const (
+	// FormatYAML identifies YAML files.
+	FormatYAML Format = "yaml"
+	// FormatJSON identifies JSON files.
+	FormatJSON Format = "json"
+	// FormatINI identifies INI files.
+	FormatINI Format = "ini"
+	// FormatDotenv identifies dotenv files.
+	FormatDotenv Format = "dotenv"
+	// FormatBinary identifies arbitrary files which SOPS stores in a JSON
+	// envelope.
+	FormatBinary Format = "binary"
+)
+
+// Formats contains all supported formats.
+var Formats = []Format{
+	FormatYAML,
+	FormatJSON,
+	FormatINI,
+	FormatDotenv,
+	FormatBinary,
+}
+
+// sniffFormats contains the formats to try, in order, for files whose format
+// cannot be determined from their path. JSON comes before YAML, because YAML
+// is a superset of JSON. Binary files use the JSON store, so there is no need
+// to try them separately.
+var sniffFormats = []Format{
+	FormatJSON,
+	FormatYAML,
+	FormatINI,
+	FormatDotenv,
+}
+
+// defaultExtensions maps file extensions to formats, like SOPS does.
+var defaultExtensions = map[string]Format{
+	".ini":  FormatINI,
+	".env":  FormatDotenv,
+	".yaml": FormatYAML,
+	".yml":  FormatYAML,
+	".json": FormatJSON,
+}
+
+// ParseFormat parses the name of a format. Returns an error if the format is
+// not supported.
+func ParseFormat(name string) (Format, error) {
+	format := Format(name)
+	if !slices.Contains(Formats, format) {
+		return "", fmt.Errorf("format must be one of %v, got %q", Formats, name)
+	}
+
+	return format, nil
+}
+
+func getStore(format Format) sops.Store {
+	switch format {
+	case FormatINI:
+		return &ini.Store{}
+	case FormatDotenv:
+		return &dotenv.Store{}
+	case FormatYAML:
+		return &yaml.Store{}
+	case FormatJSON:
+		return &json.Store{}
+	case FormatBinary:
+		return &json.BinaryStore{}
+	default:
+		return nil
+	}
+}
+
+// formatOverride forces the format of files matching a gitignore-style
+// pattern.
+type formatOverride struct {
+	pattern *gitignore.GitIgnore
+	format  Format
+}
+
+// FormatResolver determines the format of files from their path. A nil
+// FormatResolver only knows the file extensions SOPS itself recognizes.
+type FormatResolver struct {
+	// extensions contains the file extensions of custom mappings, longest
+	// first, so that e.g. `.json.sops` takes precedence over `.sops`.
+	extensions []string
+	formats    map[string]Format
+	overrides  []formatOverride
+}
+
+// NewFormatResolver creates a FormatResolver from custom extension to format
+// mappings and overrides of the form `<pattern>=<format>`, where pattern is a
+// gitignore-style pattern. Overrides take precedence over extension mappings,
+// and the first matching override wins.
+func NewFormatResolver(extensions map[string]string, overrides []string) (*FormatResolver, error) {
+	r := &FormatResolver{formats: make(map[string]Format, len(extensions))}
+
+	for extension, name := range extensions {
+		format, err := ParseFormat(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid format for extension %q: %w", extension, err)
+		}
+
+		r.extensions = append(r.extensions, extension)
+		r.formats[extension] = format
+	}
+
+	sort.Slice(r.extensions, func(i, j int) bool {
+		if len(r.extensions[i]) != len(r.extensions[j]) {
+			return len(r.extensions[i]) > len(r.extensions[j])
+		}
+
+		return r.extensions[i] < r.extensions[j]
+	})
+
+	for _, override := range overrides {
+		pattern, name, ok := strings.Cut(override, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid format override %q: expected <pattern>=<format>", override)
+		}
+
+		format, err := ParseFormat(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid format override %q: %w", override, err)
+		}
+
+		r.overrides = append(r.overrides, formatOverride{
+			pattern: ignore.CompilePatterns(pattern),
+			format:  format,
+		})
+	}
+
+	return r, nil
+}
+
+// Resolve returns the format of the file at path. Returns false if the format
+// cannot be determined from the path alone.
+func (r *FormatResolver) Resolve(path string) (Format, bool) {
+	if r != nil {
+		for _, override := range r.overrides {
+			if override.pattern.MatchesPath(filepath.ToSlash(path)) {
+				return override.format, true
+			}
+		}
+
+		name := filepath.Base(path)
+
+		for _, extension := range r.extensions {
+			if strings.HasSuffix(name, extension) {
+				return r.formats[extension], true
+			}
+		}
+	}
+
+	format, ok := defaultExtensions[filepath.Ext(path)]
+
+	return format, ok
+}
+
+// loadFile loads the SOPS metadata of data in the given format. If the
+// format is unknown, all supported formats are tried, and the format that
+// could load data is returned. Returns sops.MetadataNotFound if data does not
+// contain any SOPS metadata, or if the format is unknown and none of the
+// formats could load it.
+func loadFile(data []byte, format Format, known bool) (sops.Metadata, Format, error) {
+	if known {
+		tree, err := getStore(format).LoadEncryptedFile(data)
+		return tree.Metadata, format, err
+	}
+
+	// Every supported format contains the string "sops" in its metadata, so
+	// this is a cheap way to avoid parsing files that are not SOPS files.
+	if !bytes.Contains(data, []byte("sops")) {
+		return sops.Metadata{}, "", sops.MetadataNotFound
+	}
+
+	for _, format := range sniffFormats {
+		tree, err := getStore(format).LoadEncryptedFile(data)
+		if err == nil {
+			return tree.Metadata, format, nil
+		}
+	}
+
+	return sops.Metadata{}, "", sops.MetadataNotFound
+}
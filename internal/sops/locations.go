@@ -0,0 +1,244 @@
+package sops
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// Region is a position within a file. Lines and columns start at 1.
+type Region struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Locations contains the positions of the SOPS metadata within a file.
+type Locations struct {
+	// Metadata is the position of the SOPS metadata, e.g. of the `sops` key
+	// in YAML and JSON files.
+	Metadata Region
+	// TrustAnchors maps trust anchor identifiers to the positions of their
+	// entries in the SOPS metadata, in file order. A trust anchor has
+	// multiple entries if it is part of multiple key groups.
+	TrustAnchors map[string][]Region
+}
+
+// keyEntry identifies the entry of a master key in the SOPS metadata by its
+// key group, its type and its index among the keys of that type within the
+// key group. SOPS preserves the order of keys of the same type, so this
+// identifies the same key in the file and in the loaded metadata.
+type keyEntry struct {
+	group   int
+	keyType KeyType
+	index   int
+}
+
+// entryLocations are the positions found while scanning the SOPS metadata of
+// a file.
+type entryLocations struct {
+	metadata Region
+	entries  map[keyEntry]Region
+}
+
+// locate determines the positions of the SOPS metadata and of the entries of
+// the trust anchors in keyGroups within data. Returns nil if data cannot be
+// scanned.
+func locate(data []byte, format Format, keyGroups [][]TrustAnchor) *Locations {
+	var found *entryLocations
+
+	switch format {
+	case FormatINI:
+		found = locateFlattened(data, "", true)
+	case FormatDotenv:
+		found = locateFlattened(data, "sops_", false)
+	default:
+		// The stores for JSON and binary files write JSON, which the YAML
+		// parser understands as well.
+		found = locateYAML(data)
+	}
+
+	if found == nil {
+		return nil
+	}
+
+	locations := &Locations{
+		Metadata:     found.metadata,
+		TrustAnchors: make(map[string][]Region),
+	}
+
+	for i, keyGroup := range keyGroups {
+		counts := make(map[KeyType]int)
+
+		for _, anchor := range keyGroup {
+			entry := keyEntry{group: i, keyType: anchor.Type, index: counts[anchor.Type]}
+			counts[anchor.Type]++
+
+			if region, ok := found.entries[entry]; ok {
+				locations.TrustAnchors[anchor.ID] = append(locations.TrustAnchors[anchor.ID], region)
+			}
+		}
+	}
+
+	return locations
+}
+
+// locateYAML scans the SOPS metadata of YAML and JSON files.
+func locateYAML(data []byte) *entryLocations {
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return nil
+	}
+
+	for _, doc := range file.Docs {
+		for _, value := range mappingValues(doc.Body) {
+			if value.Key.GetToken().Value != "sops" {
+				continue
+			}
+
+			found := &entryLocations{
+				metadata: nodeRegion(value.Key),
+				entries:  make(map[keyEntry]Region),
+			}
+
+			for _, field := range mappingValues(value.Value) {
+				if field.Key.GetToken().Value == "key_groups" {
+					for i, group := range sequenceValues(field.Value) {
+						locateYAMLKeyGroup(found, i, group)
+					}
+				}
+			}
+
+			locateYAMLKeyGroup(found, 0, value.Value)
+
+			return found
+		}
+	}
+
+	return nil
+}
+
+// locateYAMLKeyGroup records the positions of the master keys in node, which
+// is either the SOPS metadata or one of its key groups.
+func locateYAMLKeyGroup(found *entryLocations, group int, node ast.Node) {
+	for _, field := range mappingValues(node) {
+		keyType := KeyType(field.Key.GetToken().Value)
+		if !slices.Contains(KeyTypes, keyType) {
+			continue
+		}
+
+		for i, key := range sequenceValues(field.Value) {
+			entry := keyEntry{group: group, keyType: keyType, index: i}
+
+			// Top-level keys are ignored by SOPS if there are key groups.
+			if _, ok := found.entries[entry]; !ok {
+				found.entries[entry] = nodeRegion(key)
+			}
+		}
+	}
+}
+
+func mappingValues(node ast.Node) []*ast.MappingValueNode {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		return n.Values
+	case *ast.MappingValueNode:
+		return []*ast.MappingValueNode{n}
+	default:
+		return nil
+	}
+}
+
+func sequenceValues(node ast.Node) []ast.Node {
+	if n, ok := node.(*ast.SequenceNode); ok {
+		return n.Values
+	}
+
+	return nil
+}
+
+// nodeRegion returns the position of node. The position of a mapping is that
+// of its first key, which is more useful than that of a `{` on its own line.
+func nodeRegion(node ast.Node) Region {
+	if values := mappingValues(node); len(values) > 0 {
+		node = values[0].Key
+	}
+
+	position := node.GetToken().Position
+
+	return Region{Line: position.Line, Column: position.Column}
+}
+
+// flattenedKeyRegex matches the keys of master key entries, which the INI and
+// dotenv stores flatten into keys like `age__list_0__map_recipient` or
+// `key_groups__list_1__map_kms__list_0__map_arn`.
+var flattenedKeyRegex = regexp.MustCompile(`^(?:key_groups__list_(\d+)__map_)?([a-z_]+?)__list_(\d+)__map_`)
+
+// locateFlattened scans the SOPS metadata of INI and dotenv files, whose
+// metadata keys are flattened and either prefixed with prefix or contained in
+// a `[sops]` section.
+func locateFlattened(data []byte, prefix string, section bool) *entryLocations {
+	var found *entryLocations
+
+	// Top-level keys are ignored by SOPS if there are key groups.
+	topLevel := make(map[keyEntry]Region)
+	inSection := false
+
+	for i, text := range strings.Split(string(data), "\n") {
+		text = strings.TrimSpace(text)
+		region := Region{Line: i + 1, Column: 1}
+
+		if section && strings.HasPrefix(text, "[") {
+			inSection = text == "[sops]"
+
+			if inSection && found == nil {
+				found = &entryLocations{metadata: region, entries: make(map[keyEntry]Region)}
+			}
+
+			continue
+		}
+
+		key, _, ok := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+
+		if !ok || (section && !inSection) || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		if found == nil {
+			found = &entryLocations{metadata: region, entries: make(map[keyEntry]Region)}
+		}
+
+		match := flattenedKeyRegex.FindStringSubmatch(strings.TrimPrefix(key, prefix))
+		if match == nil || !slices.Contains(KeyTypes, KeyType(match[2])) {
+			continue
+		}
+
+		group, _ := strconv.Atoi(match[1])
+		index, _ := strconv.Atoi(match[3])
+		entry := keyEntry{group: group, keyType: KeyType(match[2]), index: index}
+
+		entries := found.entries
+		if match[1] == "" {
+			entries = topLevel
+		}
+
+		// Each entry spans multiple lines, one per field.
+		if _, ok := entries[entry]; !ok {
+			entries[entry] = region
+		}
+	}
+
+	if found != nil {
+		for entry, region := range topLevel {
+			if _, ok := found.entries[entry]; !ok {
+				found.entries[entry] = region
+			}
+		}
+	}
+
+	return found
+}
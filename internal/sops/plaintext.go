@@ -0,0 +1,100 @@
+package sops
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/Bonial-International-GmbH/sops-check/internal/ignore"
+)
+
+// PlaintextFile is a file without SOPS metadata at a location where an
+// encrypted SOPS file is expected.
+type PlaintextFile struct {
+	Path string
+	// Reason describes why the file is expected to be encrypted.
+	Reason string
+}
+
+// FindPlaintextFiles returns all plain files of result which are expected to
+// be encrypted, either because they match any of the gitignore-style patterns
+// or because SOPS would apply a creation rule with a path_regex to them. Like
+// SOPS, only the first matching creation rule of the .sops.yaml file in the
+// nearest parent directory is considered. Catch-all creation rules without
+// path_regex are ignored, as they would match every file.
+func FindPlaintextFiles(result *FindResult, patterns []string) ([]PlaintextFile, error) {
+	creationRules, err := creationRulesByDir(result.ConfigFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	required := ignore.CompilePatterns(patterns...)
+
+	var plaintextFiles []PlaintextFile
+
+	for _, path := range result.PlainFiles {
+		if len(patterns) > 0 && required.MatchesPath(filepath.ToSlash(path)) {
+			plaintextFiles = append(plaintextFiles, PlaintextFile{
+				Path:   path,
+				Reason: "it matches a requireEncrypted pattern",
+			})
+			continue
+		}
+
+		rule, err := nearestCreationRule(creationRules, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if rule != nil && rule.PathRegex != "" {
+			plaintextFiles = append(plaintextFiles, PlaintextFile{
+				Path:   path,
+				Reason: fmt.Sprintf("it matches %s in %s", rule.String(), rule.ConfigPath),
+			})
+		}
+	}
+
+	return plaintextFiles, nil
+}
+
+// creationRulesByDir loads the creation rules of all given .sops.yaml files,
+// keyed by the absolute path of their directory.
+func creationRulesByDir(configFiles []string) (map[string][]CreationRule, error) {
+	creationRules := make(map[string][]CreationRule, len(configFiles))
+
+	for _, configFile := range configFiles {
+		dir, err := filepath.Abs(filepath.Dir(configFile))
+		if err != nil {
+			return nil, err
+		}
+
+		rules, err := LoadCreationRules(configFile)
+		if err != nil {
+			return nil, err
+		}
+
+		creationRules[dir] = rules
+	}
+
+	return creationRules, nil
+}
+
+// nearestCreationRule returns the creation rule that SOPS would apply to the
+// file at path, i.e. the first matching rule of the .sops.yaml file in the
+// nearest parent directory. Returns nil if none of the rules of that file
+// match, or if there is no .sops.yaml file in any of the parent directories.
+func nearestCreationRule(creationRules map[string][]CreationRule, path string) (*CreationRule, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for dir := filepath.Dir(absPath); ; dir = filepath.Dir(dir) {
+		if rules, ok := creationRules[dir]; ok {
+			return matchCreationRule(rules, absPath)
+		}
+
+		if filepath.Dir(dir) == dir {
+			return nil, nil
+		}
+	}
+}
@@ -1,86 +1,382 @@
 package sops
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"io/fs"
-	"log/slog"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 
+	"github.com/Bonial-International-GmbH/sops-check/internal/ignore"
+	"github.com/Bonial-International-GmbH/sops-check/internal/parallel"
 	"github.com/getsops/sops/v3"
-	"github.com/getsops/sops/v3/stores/dotenv"
-	"github.com/getsops/sops/v3/stores/ini"
-	"github.com/getsops/sops/v3/stores/json"
-	"github.com/getsops/sops/v3/stores/yaml"
-	ignore "github.com/sabhiram/go-gitignore"
 )
 
-func getStore(fileType string) (sops.Store, error) {
-	switch fileType {
-	case ".ini":
-		return &ini.Store{}, nil
-	case ".env":
-		return &dotenv.Store{}, nil
-	case ".yaml", ".yml":
-		return &yaml.Store{}, nil
-	case ".json":
-		return &json.Store{}, nil
-	default:
-		return nil, fmt.Errorf("unsupported file type: %s", fileType)
-	}
-}
+// encryptedValueMarker is the prefix of values encrypted by SOPS.
+const encryptedValueMarker = "ENC[AES256_GCM,"
 
 // File represents a SOPS file and its metadata
 type File struct {
 	Path     string
 	Metadata sops.Metadata
+	// Locations contains the positions of the SOPS metadata within the file.
+	// It is nil if they could not be determined.
+	Locations *Locations
 }
 
-// FindFiles searches a directory for YAML files and checks if they are valid SOPS files.
-func FindFiles(root string, ignoreObjects []*ignore.GitIgnore) ([]File, error) {
-	var sopsFiles []File
+// MalformedFile is a file which was recognized as a SOPS file, but whose SOPS
+// metadata could not be loaded, e.g. because it is invalid or missing despite
+// encrypted values.
+type MalformedFile struct {
+	Path string
+	Err  error
+}
 
-	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
+// UnreadableFile is a file which could not be read, e.g. because of missing
+// permissions or because it is a broken symlink.
+type UnreadableFile struct {
+	Path string
+	Err  error
+}
+
+// FindResult contains all files found by FindFiles.
+type FindResult struct {
+	// Files contains all valid SOPS files.
+	Files []File
+	// MalformedFiles contains files which were recognized as SOPS files, but
+	// whose SOPS metadata could not be loaded.
+	MalformedFiles []MalformedFile
+	// UnreadableFiles contains files which could not be read.
+	UnreadableFiles []UnreadableFile
+	// ConfigFiles contains the paths of all .sops.yaml files.
+	ConfigFiles []string
+	// PlainFiles contains the paths of all other files, i.e. files without
+	// SOPS metadata.
+	PlainFiles []string
+}
+
+// Append adds the files of other to r.
+func (r *FindResult) Append(other *FindResult) {
+	r.Files = append(r.Files, other.Files...)
+	r.MalformedFiles = append(r.MalformedFiles, other.MalformedFiles...)
+	r.UnreadableFiles = append(r.UnreadableFiles, other.UnreadableFiles...)
+	r.ConfigFiles = append(r.ConfigFiles, other.ConfigFiles...)
+	r.PlainFiles = append(r.PlainFiles, other.PlainFiles...)
+}
+
+// FindOptions configures FindFiles.
+type FindOptions struct {
+	// Ignore decides which files and directories to skip. If nil, no files
+	// are skipped.
+	Ignore *ignore.Matcher
+	// MaxDepth limits how many levels of directories below the root are
+	// walked, where 1 only includes files directly in the root. If not
+	// positive, there is no limit.
+	MaxDepth int
+	// FollowSymlinks enables walking into symlinked directories, which are
+	// skipped otherwise. Symlinks pointing to one of their parent directories
+	// are always skipped.
+	FollowSymlinks bool
+	// Formats determines the format of files from their path. Files whose
+	// format cannot be determined are tried in all supported formats.
+	Formats *FormatResolver
+	// Jobs is the number of files to read and parse concurrently. Defaults
+	// to GOMAXPROCS if not positive.
+	Jobs int
+	// Files restricts the search to the given files instead of walking the
+	// root directory, e.g. to only check files changed in git. Ignore
+	// patterns still apply. Directories are skipped. The .sops.yaml files in
+	// the parent directories of the given files, up to the root directory,
+	// are found as well, as their creation rules apply to the given files.
+	Files []string
+}
+
+// fileKind classifies a file found by FindFiles.
+type fileKind int
+
+const (
+	kindPlain fileKind = iota
+	kindSOPS
+	kindMalformed
+	kindUnreadable
+	kindConfig
+)
+
+// foundFile is the result of loading a single file.
+type foundFile struct {
+	kind fileKind
+	path string
+	file *File
+	err  error
+}
+
+// FindFiles searches a directory for files and checks if they are valid SOPS files.
+// It also collects malformed SOPS files and the paths of all .sops.yaml files
+// found along the way. Files are read and parsed concurrently while the
+// directory is walked, but all results are in walk order.
+func FindFiles(root string, opts FindOptions) (*FindResult, error) {
+	walk := func(emit func(string)) error {
+		if opts.Files != nil {
+			for _, path := range opts.Files {
+				if info, err := os.Stat(path); err == nil && info.IsDir() {
+					continue
+				}
+
+				ignored, err := opts.Ignore.Match(path, false)
+				if err != nil {
+					return err
+				}
+
+				if !ignored {
+					emit(path)
+				}
+			}
 
-		// Skip directories
-		if d.IsDir() {
 			return nil
 		}
 
-		// Skip files that are ignored
-		for _, ignoreObject := range ignoreObjects {
-			if ignoreObject.MatchesPath(path) {
-				return nil
+		w := &walker{
+			ignore:         opts.Ignore,
+			maxDepth:       opts.MaxDepth,
+			followSymlinks: opts.FollowSymlinks,
+			emit:           emit,
+		}
+
+		return w.walk(root)
+	}
+
+	found, err := parallel.Map(opts.Jobs, walk, func(path string) foundFile {
+		return loadFoundFile(path, opts.Formats)
+	})
+
+	result := &FindResult{}
+
+	for _, file := range found {
+		switch file.kind {
+		case kindSOPS:
+			result.Files = append(result.Files, *file.file)
+		case kindMalformed:
+			result.MalformedFiles = append(result.MalformedFiles, MalformedFile{Path: file.path, Err: file.err})
+		case kindUnreadable:
+			result.UnreadableFiles = append(result.UnreadableFiles, UnreadableFile{Path: file.path, Err: file.err})
+		case kindConfig:
+			result.ConfigFiles = append(result.ConfigFiles, file.path)
+		default:
+			result.PlainFiles = append(result.PlainFiles, file.path)
+		}
+	}
+
+	if err == nil && opts.Files != nil {
+		// The creation rules of .sops.yaml files apply to the listed files,
+		// even if the .sops.yaml files themselves are not listed.
+		var configFiles []string
+
+		configFiles, err = FindConfigFiles(root, opts.Files, opts.Ignore)
+
+		for _, path := range configFiles {
+			if !slices.Contains(result.ConfigFiles, path) {
+				result.ConfigFiles = append(result.ConfigFiles, path)
 			}
 		}
+	}
 
-		ext := filepath.Ext(d.Name())
+	return result, err
+}
 
-		store, err := getStore(ext)
-		if err != nil {
-			return nil
+// FindConfigFiles returns the .sops.yaml files in the parent directories of
+// files, up to root, which are not ignored by matcher.
+func FindConfigFiles(root string, files []string, matcher *ignore.Matcher) ([]string, error) {
+	var configFiles []string
+
+	root = filepath.Clean(root)
+
+	for _, file := range files {
+		for dir := filepath.Dir(filepath.Clean(file)); ; dir = filepath.Dir(dir) {
+			relPath, err := filepath.Rel(root, dir)
+			if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+				break
+			}
+
+			path := filepath.Join(dir, ConfigFileName)
+
+			if info, err := os.Stat(path); err == nil && !info.IsDir() && !slices.Contains(configFiles, path) {
+				ignored, err := matcher.Match(path, false)
+				if err != nil {
+					return nil, err
+				}
+
+				if !ignored {
+					configFiles = append(configFiles, path)
+				}
+			}
+
+			if relPath == "." {
+				break
+			}
 		}
+	}
 
-		data, err := os.ReadFile(path)
-		if err != nil {
-			slog.Warn("Could not read file:", "filepath", path, "error", err)
-			return nil
+	return configFiles, nil
+}
+
+// loadFoundFile reads the file at path and determines its kind. Binary files
+// are plain files.
+func loadFoundFile(path string, formats *FormatResolver) foundFile {
+	if filepath.Base(path) == ConfigFileName {
+		return foundFile{kind: kindConfig, path: path}
+	}
+
+	data, binary, err := readTextFile(path)
+	switch {
+	case err != nil:
+		return foundFile{kind: kindUnreadable, path: path, err: err}
+	case binary:
+		return foundFile{kind: kindPlain, path: path}
+	}
+
+	file, err := ParseFile(path, data, formats)
+	switch {
+	case err != nil:
+		return foundFile{kind: kindMalformed, path: path, err: err}
+	case file == nil:
+		return foundFile{kind: kindPlain, path: path}
+	default:
+		return foundFile{kind: kindSOPS, path: path, file: file}
+	}
+}
+
+// binarySniffLen is the number of bytes at the start of a file which are
+// checked for NUL bytes to detect binary files, like git does.
+const binarySniffLen = 8000
+
+// readTextFile reads the file at path. SOPS files are always text files, so
+// binary files like images or build artifacts are detected from their first
+// bytes and returned as binary without reading them completely.
+func readTextFile(path string) (data []byte, binary bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	prefix := make([]byte, binarySniffLen)
+
+	n, err := io.ReadFull(f, prefix)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, false, err
+	}
+
+	prefix = prefix[:n]
+
+	if bytes.IndexByte(prefix, 0) >= 0 {
+		return nil, true, nil
+	}
+
+	data, err = io.ReadAll(io.MultiReader(bytes.NewReader(prefix), f))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return data, false, nil
+}
+
+// ParseFile parses the contents of the file at path. The format is determined
+// by formats, falling back to trying all supported formats. Returns nil if
+// data is not a SOPS file, and an error if it looks like a malformed one.
+func ParseFile(path string, data []byte, formats *FormatResolver) (*File, error) {
+	format, known := formats.Resolve(path)
+
+	return parseFile(path, data, format, known)
+}
+
+// ParseFileAs is like ParseFile, but parses data in the given format,
+// regardless of path.
+func ParseFileAs(path string, data []byte, format Format) (*File, error) {
+	return parseFile(path, data, format, true)
+}
+
+func parseFile(path string, data []byte, format Format, known bool) (*File, error) {
+	metadata, format, err := loadFile(data, format, known)
+	if err != nil {
+		// Files of unknown format are only reported if they are valid SOPS
+		// files in one of the supported formats.
+		if !known {
+			return nil, nil
 		}
 
-		tree, err := store.LoadEncryptedFile(data)
-		if err != nil {
-			return nil
+		return nil, checkMalformed(data, format, err)
+	}
+
+	file := &File{Path: path, Metadata: metadata}
+	file.Locations = locate(data, format, file.KeyGroups())
+
+	return file, nil
+}
+
+// checkMalformed distinguishes files that are not SOPS files at all from SOPS
+// files with invalid or unparseable metadata, given the error returned while
+// loading them in format. Returns nil if data does not look like a SOPS file.
+func checkMalformed(data []byte, format Format, loadErr error) error {
+	if errors.Is(loadErr, sops.MetadataNotFound) {
+		if bytes.Contains(data, []byte(encryptedValueMarker)) {
+			return errors.New("file contains encrypted values, but no sops metadata")
 		}
 
-		sopsFiles = append(sopsFiles, File{Path: path, Metadata: tree.Metadata})
+		return nil
+	}
 
+	// Plain files in a supported format that fail to parse are not
+	// considered SOPS files unless they contain the SOPS metadata key.
+	if !hasMetadataKey(data, format) {
 		return nil
-	})
+	}
 
-	return sopsFiles, err
+	return fmt.Errorf("invalid sops metadata: %w", loadErr)
+}
+
+// metadataKeyRegexes match the key of the SOPS metadata in each format, even
+// if the file cannot be parsed as a whole.
+var metadataKeyRegexes = map[Format]*regexp.Regexp{
+	FormatYAML:   regexp.MustCompile(`(?m)^["']?sops["']?\s*:`),
+	FormatJSON:   regexp.MustCompile(`"sops"\s*:`),
+	FormatBinary: regexp.MustCompile(`"sops"\s*:`),
+	FormatINI:    regexp.MustCompile(`(?m)^\s*\[sops\]\s*$`),
+	FormatDotenv: regexp.MustCompile(`(?m)^sops_\w+=`),
+}
+
+// hasMetadataKey returns true if data contains the key of the SOPS metadata
+// of the given format.
+func hasMetadataKey(data []byte, format Format) bool {
+	regex, ok := metadataKeyRegexes[format]
+
+	return ok && regex.Match(data)
+}
+
+// TrustAnchors extracts and returns a list of structured trust anchors from the
+// given sops.Metadata.
+func (f *File) TrustAnchors() []TrustAnchor {
+	var anchors []TrustAnchor
+	for _, keyGroup := range f.KeyGroups() {
+		anchors = append(anchors, keyGroup...)
+	}
+	return anchors
+}
+
+// KeyGroups extracts and returns the structured trust anchors of each key
+// group from the given sops.Metadata. Unlike TrustAnchors, this preserves
+// which key group a trust anchor belongs to.
+func (f *File) KeyGroups() [][]TrustAnchor {
+	keyGroups := make([][]TrustAnchor, len(f.Metadata.KeyGroups))
+	for i, keyGroup := range f.Metadata.KeyGroups {
+		for _, key := range keyGroup {
+			keyGroups[i] = append(keyGroups[i], NewTrustAnchor(key))
+		}
+	}
+	return keyGroups
 }
 
 // ExctractKeys extracts and returns a list of keys from the given sops.Metadata
@@ -0,0 +1,301 @@
+package sops
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	gosops "github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/azkv"
+	sopsconfig "github.com/getsops/sops/v3/config"
+	"github.com/getsops/sops/v3/gcpkms"
+	"github.com/getsops/sops/v3/hcvault"
+	"github.com/getsops/sops/v3/kms"
+	"github.com/getsops/sops/v3/pgp"
+	"github.com/goccy/go-yaml"
+)
+
+// ConfigFileName is the name of SOPS configuration files.
+const ConfigFileName = ".sops.yaml"
+
+// configFile contains the parts of a .sops.yaml file that are relevant for
+// resolving its creation rules, in the format read by SOPS.
+type configFile struct {
+	CreationRules []creationRule `yaml:"creation_rules"`
+}
+
+type creationRule struct {
+	PathRegex               string     `yaml:"path_regex"`
+	KMS                     string     `yaml:"kms"`
+	AWSProfile              string     `yaml:"aws_profile"`
+	Age                     string     `yaml:"age"`
+	PGP                     string     `yaml:"pgp"`
+	GCPKMS                  string     `yaml:"gcp_kms"`
+	AzureKeyVault           string     `yaml:"azure_keyvault"`
+	VaultURI                string     `yaml:"hc_vault_transit_uri"`
+	KeyGroups               []keyGroup `yaml:"key_groups"`
+	ShamirThreshold         int        `yaml:"shamir_threshold"`
+	UnencryptedSuffix       string     `yaml:"unencrypted_suffix"`
+	EncryptedSuffix         string     `yaml:"encrypted_suffix"`
+	UnencryptedRegex        string     `yaml:"unencrypted_regex"`
+	EncryptedRegex          string     `yaml:"encrypted_regex"`
+	UnencryptedCommentRegex string     `yaml:"unencrypted_comment_regex"`
+	EncryptedCommentRegex   string     `yaml:"encrypted_comment_regex"`
+	MACOnlyEncrypted        bool       `yaml:"mac_only_encrypted"`
+}
+
+type keyGroup struct {
+	Merge []keyGroup `yaml:"merge"`
+	KMS   []struct {
+		ARN        string             `yaml:"arn"`
+		Role       string             `yaml:"role"`
+		Context    map[string]*string `yaml:"context"`
+		AWSProfile string             `yaml:"aws_profile"`
+	} `yaml:"kms"`
+	GCPKMS []struct {
+		ResourceID string `yaml:"resource_id"`
+	} `yaml:"gcp_kms"`
+	AzureKV []struct {
+		VaultURL string `yaml:"vaultUrl"`
+		Key      string `yaml:"key"`
+		Version  string `yaml:"version"`
+	} `yaml:"azure_keyvault"`
+	Vault []string `yaml:"hc_vault"`
+	Age   []string `yaml:"age"`
+	PGP   []string `yaml:"pgp"`
+}
+
+// LoadCreationRules parses the .sops.yaml file at configPath and returns all
+// of its creation rules along with the trust anchors that SOPS would use for
+// files matching them.
+func LoadCreationRules(configPath string) ([]CreationRule, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var config configFile
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", configPath, err)
+	}
+
+	rules := make([]CreationRule, len(config.CreationRules))
+
+	for i, rule := range config.CreationRules {
+		resolved, err := rule.resolve()
+		if err != nil {
+			return nil, fmt.Errorf("invalid creation rule %d in %s: %w", i, configPath, err)
+		}
+
+		rules[i] = *newCreationRule(configPath, resolved)
+		rules[i].Index = i
+		rules[i].PathRegex = rule.PathRegex
+	}
+
+	return rules, nil
+}
+
+// resolve creates the configuration that SOPS would use for files matching
+// the creation rule, following the same rules as the SOPS config loader.
+func (r *creationRule) resolve() (*sopsconfig.Config, error) {
+	encryptionSettings := 0
+
+	for _, setting := range []string{
+		r.UnencryptedSuffix, r.EncryptedSuffix,
+		r.UnencryptedRegex, r.EncryptedRegex,
+		r.UnencryptedCommentRegex, r.EncryptedCommentRegex,
+	} {
+		if setting != "" {
+			encryptionSettings++
+		}
+	}
+
+	if encryptionSettings > 1 {
+		return nil, errors.New("cannot use more than one of encrypted_suffix, unencrypted_suffix, encrypted_regex, unencrypted_regex, encrypted_comment_regex, or unencrypted_comment_regex for the same rule")
+	}
+
+	keyGroups, err := r.keyGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	return &sopsconfig.Config{
+		KeyGroups:               keyGroups,
+		ShamirThreshold:         r.ShamirThreshold,
+		UnencryptedSuffix:       r.UnencryptedSuffix,
+		EncryptedSuffix:         r.EncryptedSuffix,
+		UnencryptedRegex:        r.UnencryptedRegex,
+		EncryptedRegex:          r.EncryptedRegex,
+		UnencryptedCommentRegex: r.UnencryptedCommentRegex,
+		EncryptedCommentRegex:   r.EncryptedCommentRegex,
+		MACOnlyEncrypted:        r.MACOnlyEncrypted,
+	}, nil
+}
+
+// keyGroups returns the master keys of each key group of the creation rule.
+// If the rule does not define any key groups, the keys defined at the top
+// level of the rule form a single key group.
+func (r *creationRule) keyGroups() ([]gosops.KeyGroup, error) {
+	if len(r.KeyGroups) == 0 {
+		group, err := r.topLevelKeys()
+		if err != nil {
+			return nil, err
+		}
+
+		return []gosops.KeyGroup{group}, nil
+	}
+
+	groups := make([]gosops.KeyGroup, len(r.KeyGroups))
+
+	for i, keyGroup := range r.KeyGroups {
+		group, err := keyGroup.masterKeys()
+		if err != nil {
+			return nil, err
+		}
+
+		groups[i] = deduplicateKeys(group)
+	}
+
+	return groups, nil
+}
+
+// topLevelKeys returns the master keys defined at the top level of the
+// creation rule.
+func (r *creationRule) topLevelKeys() (gosops.KeyGroup, error) {
+	var group gosops.KeyGroup
+
+	if r.Age != "" {
+		ageKeys, err := age.MasterKeysFromRecipients(r.Age)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range ageKeys {
+			group = append(group, key)
+		}
+	}
+
+	for _, key := range pgp.MasterKeysFromFingerprintString(r.PGP) {
+		group = append(group, key)
+	}
+
+	for _, key := range kms.MasterKeysFromArnString(r.KMS, nil, r.AWSProfile) {
+		group = append(group, key)
+	}
+
+	for _, key := range gcpkms.MasterKeysFromResourceIDString(r.GCPKMS) {
+		group = append(group, key)
+	}
+
+	azureKeys, err := azkv.MasterKeysFromURLs(r.AzureKeyVault)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range azureKeys {
+		group = append(group, key)
+	}
+
+	vaultKeys, err := hcvault.NewMasterKeysFromURIs(r.VaultURI)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range vaultKeys {
+		group = append(group, key)
+	}
+
+	return group, nil
+}
+
+// masterKeys returns the master keys of the key group, including those of
+// merged key groups.
+func (g *keyGroup) masterKeys() (gosops.KeyGroup, error) {
+	var group gosops.KeyGroup
+
+	for _, merged := range g.Merge {
+		mergedKeys, err := merged.masterKeys()
+		if err != nil {
+			return nil, err
+		}
+
+		group = append(group, mergedKeys...)
+	}
+
+	for _, recipient := range g.Age {
+		ageKeys, err := age.MasterKeysFromRecipients(recipient)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range ageKeys {
+			group = append(group, key)
+		}
+	}
+
+	for _, fingerprint := range g.PGP {
+		group = append(group, pgp.NewMasterKeyFromFingerprint(fingerprint))
+	}
+
+	for _, key := range g.KMS {
+		group = append(group, kms.NewMasterKeyWithProfile(key.ARN, key.Role, key.Context, key.AWSProfile))
+	}
+
+	for _, key := range g.GCPKMS {
+		group = append(group, gcpkms.NewMasterKeyFromResourceID(key.ResourceID))
+	}
+
+	for _, key := range g.AzureKV {
+		group = append(group, azkv.NewMasterKey(key.VaultURL, key.Key, key.Version))
+	}
+
+	for _, uri := range g.Vault {
+		key, err := hcvault.NewMasterKeyFromURI(uri)
+		if err != nil {
+			return nil, err
+		}
+
+		group = append(group, key)
+	}
+
+	return group, nil
+}
+
+// deduplicateKeys removes keys which occur multiple times in group, e.g.
+// because of merged key groups, like SOPS does.
+func deduplicateKeys(group gosops.KeyGroup) gosops.KeyGroup {
+	var deduplicated gosops.KeyGroup
+
+	seen := make(map[string]bool, len(group))
+
+	for _, key := range group {
+		if id := fmt.Sprintf("%T/%s", key, key.ToString()); !seen[id] {
+			seen[id] = true
+			deduplicated = append(deduplicated, key)
+		}
+	}
+
+	return deduplicated
+}
+
+// String returns a human readable identifier of the creation rule within its
+// .sops.yaml file.
+func (r *CreationRule) String() string {
+	if r.PathRegex == "" {
+		return fmt.Sprintf("creation_rules[%d] (matches all files)", r.Index)
+	}
+
+	return fmt.Sprintf("creation_rules[%d] (path_regex: %q)", r.Index, r.PathRegex)
+}
+
+// Metadata returns the SOPS metadata that a file encrypted with the creation
+// rule at the given point in time would have. The version is left empty, as it
+// depends on the SOPS binary that encrypts the file.
+func (r *CreationRule) Metadata(now time.Time) *gosops.Metadata {
+	metadata := r.metadata
+	metadata.LastModified = now
+
+	return &metadata
+}
@@ -1,16 +1,21 @@
 package sops
 
 import (
+	"os"
+	"path/filepath"
 	"sort"
 	"testing"
+	"time"
 
+	"github.com/Bonial-International-GmbH/sops-check/internal/ignore"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/getsops/sops/v3"
 	"github.com/getsops/sops/v3/age"
 	"github.com/getsops/sops/v3/keys"
 	"github.com/getsops/sops/v3/kms"
-	ignore "github.com/sabhiram/go-gitignore"
+	"github.com/getsops/sops/v3/pgp"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSingleIgnoreFile(t *testing.T) {
@@ -22,15 +27,20 @@ func TestSingleIgnoreFile(t *testing.T) {
 		{Path: "testdata/valid_sops_files/encrypted.json", Metadata: sops.Metadata{}},
 	}
 
-	ignoreObject, err := ignore.CompileIgnoreFile(testDir + "/ignorefiles/.ymlignorefile")
+	matcher, err := ignore.New(ignore.Options{
+		Root:        testDir,
+		IgnoreFiles: []string{testDir + "/ignorefiles/.ymlignorefile"},
+	})
 	if err != nil {
 		t.Errorf("Failed to process ignore file")
 	}
 
 	// Loop through files in the testdata directory.
-	files, err := FindFiles(testDir, []*ignore.GitIgnore{ignoreObject})
+	result, err := FindFiles(testDir, FindOptions{Ignore: matcher})
 	assert.NoError(t, err)
 
+	files := result.Files
+
 	sort.Slice(files, func(i, j int) bool {
 		return files[i].Path < files[j].Path
 	})
@@ -52,19 +62,23 @@ func TestMultipleIgnoreFiles(t *testing.T) {
 		{Path: "testdata/valid_sops_files/encrypted.ini", Metadata: sops.Metadata{}},
 	}
 
-	ignoreObject1, err := ignore.CompileIgnoreFile(testDir + "/ignorefiles/.ymlignorefile")
-	if err != nil {
-		t.Errorf("Failed to process ignore file %s", testDir+"/ignorefiles/.ymlignorefile")
-	}
-	ignoreObject2, err := ignore.CompileIgnoreFile(testDir + "/ignorefiles/.jsonignorefile")
+	matcher, err := ignore.New(ignore.Options{
+		Root: testDir,
+		IgnoreFiles: []string{
+			testDir + "/ignorefiles/.ymlignorefile",
+			testDir + "/ignorefiles/.jsonignorefile",
+		},
+	})
 	if err != nil {
-		t.Errorf("Failed to process ignore file %s", testDir+"/ignorefiles/.jsonignorefile")
+		t.Errorf("Failed to process ignore files")
 	}
 
 	// Loop through files in the testdata directory.
-	files, err := FindFiles(testDir, []*ignore.GitIgnore{ignoreObject1, ignoreObject2})
+	result, err := FindFiles(testDir, FindOptions{Ignore: matcher})
 	assert.NoError(t, err)
 
+	files := result.Files
+
 	sort.Slice(files, func(i, j int) bool {
 		return files[i].Path < files[j].Path
 	})
@@ -82,9 +96,51 @@ func TestInvalidSopsFiles(t *testing.T) {
 	testDir := "testdata/invalid_sops_files"
 
 	// Loop through files in the testdata directory.
-	files, err := FindFiles(testDir, nil)
+	result, err := FindFiles(testDir, FindOptions{})
 	assert.NoError(t, err)
-	assert.Empty(t, files)
+	assert.Empty(t, result.Files)
+
+	assert.Len(t, result.MalformedFiles, 2)
+	assert.Equal(t, "testdata/invalid_sops_files/bad_matadata.yaml", result.MalformedFiles[0].Path)
+	assert.EqualError(t, result.MalformedFiles[0].Err, "file contains encrypted values, but no sops metadata")
+	assert.Equal(t, "testdata/invalid_sops_files/corrupt_metadata.yaml", result.MalformedFiles[1].Path)
+	assert.ErrorContains(t, result.MalformedFiles[1].Err, "invalid sops metadata: parsing time \"yesterday\"")
+}
+
+func TestMalformedDetection(t *testing.T) {
+	root := t.TempDir()
+
+	for name, content := range map[string]string{
+		"broken_sops.yaml":  "data: value\nsops:\n  age: [\n",
+		"broken_plain.yaml": "description: see the sops docs\n  list: [\n",
+		"broken_sops.json":  `{"data": "value", "sops": {`,
+		"broken_plain.json": `{"description": "see the sops docs", `,
+		// Binary files are never SOPS files and are not read completely.
+		"binary.yaml": "\x00\x01\nsops:\n  version: [\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(content), 0o600))
+	}
+
+	require.NoError(t, os.Symlink("missing.yaml", filepath.Join(root, "link.yaml")))
+
+	result, err := FindFiles(root, FindOptions{})
+	require.NoError(t, err)
+
+	var malformed []string
+	for _, file := range result.MalformedFiles {
+		malformed = append(malformed, filepath.Base(file.Path))
+	}
+
+	assert.Equal(t, []string{"broken_sops.json", "broken_sops.yaml"}, malformed)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(root, "binary.yaml"),
+		filepath.Join(root, "broken_plain.json"),
+		filepath.Join(root, "broken_plain.yaml"),
+	}, result.PlainFiles)
+
+	require.Len(t, result.UnreadableFiles, 1)
+	assert.Equal(t, filepath.Join(root, "link.yaml"), result.UnreadableFiles[0].Path)
+	assert.ErrorIs(t, result.UnreadableFiles[0].Err, os.ErrNotExist)
 }
 
 func TestGetKeys(t *testing.T) {
@@ -139,3 +195,567 @@ func TestGetKeys(t *testing.T) {
 		})
 	}
 }
+
+func TestTrustAnchors(t *testing.T) {
+	dummyArn := "arn:aws:kms:us-east-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+	ageKey, err := age.MasterKeyFromRecipient("age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun")
+	assert.NoError(t, err)
+	kmsKey := kms.NewMasterKey(dummyArn, "dummy-role", nil)
+	kmsKey.CreationDate = time.Date(2024, 3, 20, 10, 0, 0, 0, time.UTC)
+
+	file := File{Path: "multiple/keys", Metadata: sops.Metadata{
+		KeyGroups: []sops.KeyGroup{
+			[]keys.MasterKey{ageKey, kmsKey},
+		},
+	}}
+
+	expected := []TrustAnchor{
+		{
+			ID:     "age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun",
+			Type:   KeyTypeAge,
+			Fields: map[string]string{},
+		},
+		{
+			ID:   dummyArn + "+dummy-role",
+			Type: KeyTypeKMS,
+			Fields: map[string]string{
+				FieldARN:       dummyArn,
+				FieldPartition: "aws",
+				FieldRegion:    "us-east-2",
+				FieldAccount:   "111122223333",
+				FieldKeyID:     "1234abcd-12ab-34cd-56ef-1234567890ab",
+				FieldRole:      "dummy-role",
+			},
+			CreatedAt: time.Date(2024, 3, 20, 10, 0, 0, 0, time.UTC),
+		},
+	}
+
+	assert.Equal(t, expected, file.TrustAnchors())
+}
+
+func TestKeyGroups(t *testing.T) {
+	ageKey, err := age.MasterKeyFromRecipient("age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun")
+	assert.NoError(t, err)
+	pgpKey := pgp.NewMasterKeyFromFingerprint("FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4")
+
+	file := File{Path: "key/groups", Metadata: sops.Metadata{
+		KeyGroups: []sops.KeyGroup{
+			[]keys.MasterKey{ageKey},
+			[]keys.MasterKey{pgpKey},
+		},
+		ShamirThreshold: 2,
+	}}
+
+	keyGroups := file.KeyGroups()
+
+	assert.Len(t, keyGroups, 2)
+	assert.Equal(t, []string{"age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun"}, anchorIDs(keyGroups[0]))
+	assert.Equal(t, []string{"FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4"}, anchorIDs(keyGroups[1]))
+	assert.Len(t, file.TrustAnchors(), 2)
+}
+
+func anchorIDs(anchors []TrustAnchor) []string {
+	ids := make([]string, len(anchors))
+	for i, anchor := range anchors {
+		ids[i] = anchor.ID
+	}
+	return ids
+}
+
+func TestParseTrustAnchor(t *testing.T) {
+	tests := []struct {
+		id             string
+		expectedType   KeyType
+		expectedFields map[string]string
+	}{
+		{
+			id:           "arn:aws:kms:eu-central-1:123456789012:alias/production-cicd|env:prod",
+			expectedType: KeyTypeKMS,
+			expectedFields: map[string]string{
+				FieldARN:       "arn:aws:kms:eu-central-1:123456789012:alias/production-cicd",
+				FieldPartition: "aws",
+				FieldRegion:    "eu-central-1",
+				FieldAccount:   "123456789012",
+				FieldAlias:     "production-cicd",
+			},
+		},
+		{
+			id:           "projects/my-project/locations/global/keyRings/sops/cryptoKeys/sops-key",
+			expectedType: KeyTypeGCPKMS,
+			expectedFields: map[string]string{
+				FieldProject:  "my-project",
+				FieldLocation: "global",
+				FieldKeyRing:  "sops",
+				FieldKeyName:  "sops-key",
+			},
+		},
+		{
+			id:           "https://my-vault.vault.azure.net/keys/sops-key/0123456789abcdef",
+			expectedType: KeyTypeAzureKV,
+			expectedFields: map[string]string{
+				FieldVaultAddress: "https://my-vault.vault.azure.net",
+				FieldKeyName:      "sops-key",
+				FieldKeyVersion:   "0123456789abcdef",
+			},
+		},
+		{
+			id:           "https://vault.example.com:8200/v1/sops/keys/firstkey",
+			expectedType: KeyTypeHCVault,
+			expectedFields: map[string]string{
+				FieldVaultAddress: "https://vault.example.com:8200",
+				FieldEnginePath:   "sops",
+				FieldKeyName:      "firstkey",
+			},
+		},
+		{
+			id:             "age1yt3tfqlfrwdwx0z0ynwplcr6qxcxfaqycuprpmy89nr83ltx74tqdpszlw",
+			expectedType:   KeyTypeAge,
+			expectedFields: map[string]string{},
+		},
+		{
+			id:             "FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4",
+			expectedType:   KeyTypePGP,
+			expectedFields: map[string]string{},
+		},
+		{
+			id:             "something-else",
+			expectedType:   KeyTypeUnknown,
+			expectedFields: map[string]string{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.id, func(t *testing.T) {
+			anchor := ParseTrustAnchor(tc.id)
+
+			assert.Equal(t, tc.id, anchor.ID)
+			assert.Equal(t, tc.expectedType, anchor.Type)
+			assert.Equal(t, tc.expectedFields, anchor.Fields)
+		})
+	}
+}
+
+func TestCreationRuleDrift(t *testing.T) {
+	dummyArn := "arn:aws:kms:us-east-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+	ageKey, err := age.MasterKeyFromRecipient("age1yt3tfqlfrwdwx0z0ynwplcr6qxcxfaqycuprpmy89nr83ltx74tqdpszlw")
+	assert.NoError(t, err)
+	otherAgeKey, err := age.MasterKeyFromRecipient("age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun")
+	assert.NoError(t, err)
+	kmsKey := kms.NewMasterKey(dummyArn, "", nil)
+
+	t.Run("matching creation rule", func(t *testing.T) {
+		file := File{Path: "testdata/creation_rules/prod/app.yaml", Metadata: sops.Metadata{
+			KeyGroups:       []sops.KeyGroup{{ageKey}, {kmsKey}},
+			ShamirThreshold: 2,
+		}}
+
+		rule, err := FindCreationRule(file.Path)
+		assert.NoError(t, err)
+		assert.NotNil(t, rule)
+		assert.Empty(t, file.CreationRuleDrift(rule))
+	})
+
+	t.Run("drifted key groups", func(t *testing.T) {
+		file := File{Path: "testdata/creation_rules/prod/app.yaml", Metadata: sops.Metadata{
+			KeyGroups: []sops.KeyGroup{{ageKey, otherAgeKey}},
+		}}
+
+		rule, err := FindCreationRule(file.Path)
+		assert.NoError(t, err)
+
+		expected := []string{
+			"Expected 2 key groups, but found 1.",
+			"Key group 1 has unexpected trust anchors: age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun",
+			"Key group 2 is missing trust anchors: " + dummyArn,
+			"Expected Shamir threshold of 2, but found 1.",
+		}
+
+		assert.Equal(t, expected, file.CreationRuleDrift(rule))
+	})
+
+	t.Run("fallback creation rule", func(t *testing.T) {
+		file := File{Path: "testdata/creation_rules/dev/app.yaml", Metadata: sops.Metadata{
+			KeyGroups: []sops.KeyGroup{{ageKey}},
+		}}
+
+		rule, err := FindCreationRule(file.Path)
+		assert.NoError(t, err)
+
+		expected := []string{
+			"Key group 1 is missing trust anchors: age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun",
+			"Key group 1 has unexpected trust anchors: age1yt3tfqlfrwdwx0z0ynwplcr6qxcxfaqycuprpmy89nr83ltx74tqdpszlw",
+		}
+
+		assert.Equal(t, expected, file.CreationRuleDrift(rule))
+	})
+
+	t.Run("no .sops.yaml", func(t *testing.T) {
+		rule, err := FindCreationRule(filepath.Join(t.TempDir(), "app.yaml"))
+		assert.NoError(t, err)
+		assert.Nil(t, rule)
+	})
+
+	t.Run("no matching creation rule", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte(`
+creation_rules:
+  - path_regex: ^prod/
+    age: age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun`), 0o600))
+
+		rule, err := FindCreationRule(filepath.Join(tmpDir, "dev", "app.yaml"))
+		assert.NoError(t, err)
+		assert.Nil(t, rule)
+
+		rule, err = FindCreationRule(filepath.Join(tmpDir, "prod", "app.yaml"))
+		assert.NoError(t, err)
+		assert.NotNil(t, rule)
+	})
+}
+
+func TestLoadCreationRules(t *testing.T) {
+	creationRules, err := LoadCreationRules("testdata/creation_rules/.sops.yaml")
+	assert.NoError(t, err)
+	assert.Len(t, creationRules, 2)
+
+	assert.Equal(t, 0, creationRules[0].Index)
+	assert.Equal(t, `creation_rules[0] (path_regex: "^prod/.*\\.yaml$")`, creationRules[0].String())
+	assert.Equal(t, 2, creationRules[0].ShamirThreshold)
+	assert.Len(t, creationRules[0].KeyGroups, 2)
+	assert.Equal(t, []string{"age1yt3tfqlfrwdwx0z0ynwplcr6qxcxfaqycuprpmy89nr83ltx74tqdpszlw"}, anchorIDs(creationRules[0].KeyGroups[0]))
+	assert.Equal(t, []string{"arn:aws:kms:us-east-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"}, anchorIDs(creationRules[0].KeyGroups[1]))
+
+	assert.Equal(t, "creation_rules[1] (matches all files)", creationRules[1].String())
+	assert.Len(t, creationRules[1].KeyGroups, 1)
+	assert.Equal(t, []string{"age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun"}, anchorIDs(creationRules[1].KeyGroups[0]))
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	metadata := creationRules[0].Metadata(now)
+	assert.Equal(t, 2, metadata.ShamirThreshold)
+	assert.Equal(t, now, metadata.LastModified)
+	assert.Empty(t, metadata.Version)
+
+	t.Run("merged key groups", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), ConfigFileName)
+		require.NoError(t, os.WriteFile(configPath, []byte(`
+creation_rules:
+  - encrypted_regex: ^data$
+    key_groups:
+      - age:
+          - age1yt3tfqlfrwdwx0z0ynwplcr6qxcxfaqycuprpmy89nr83ltx74tqdpszlw
+        merge:
+          - age:
+              - age1yt3tfqlfrwdwx0z0ynwplcr6qxcxfaqycuprpmy89nr83ltx74tqdpszlw
+              - age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun`), 0o600))
+
+		creationRules, err := LoadCreationRules(configPath)
+		require.NoError(t, err)
+		require.Len(t, creationRules, 1)
+		assert.Equal(t, []string{
+			"age1yt3tfqlfrwdwx0z0ynwplcr6qxcxfaqycuprpmy89nr83ltx74tqdpszlw",
+			"age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun",
+		}, anchorIDs(creationRules[0].KeyGroups[0]))
+		assert.Equal(t, "^data$", creationRules[0].Metadata(now).EncryptedRegex)
+	})
+
+	t.Run("conflicting encryption settings", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), ConfigFileName)
+		require.NoError(t, os.WriteFile(configPath, []byte(`
+creation_rules:
+  - encrypted_regex: ^data$
+    unencrypted_suffix: _plain
+    age: age1yt3tfqlfrwdwx0z0ynwplcr6qxcxfaqycuprpmy89nr83ltx74tqdpszlw`), 0o600))
+
+		_, err := LoadCreationRules(configPath)
+		assert.ErrorContains(t, err, "invalid creation rule 0")
+	})
+}
+
+func TestFindConfigFiles(t *testing.T) {
+	result, err := FindFiles("testdata", FindOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"testdata/creation_rules/.sops.yaml"}, result.ConfigFiles)
+}
+
+func TestFindPlaintextFiles(t *testing.T) {
+	result := &FindResult{
+		ConfigFiles: []string{"testdata/creation_rules/.sops.yaml"},
+		PlainFiles: []string{
+			"testdata/creation_rules/prod/app.yaml",
+			"testdata/creation_rules/dev/app.yaml",
+			"testdata/prod/app.yaml",
+			"testdata/other/testdata/prod/app.yaml",
+			"testdata/config/secrets.yaml",
+			"testdata/config/values.yaml",
+		},
+	}
+
+	plaintextFiles, err := FindPlaintextFiles(result, []string{"**/secrets*.yaml", "testdata/prod/**"})
+	assert.NoError(t, err)
+
+	expected := []PlaintextFile{
+		{
+			Path:   "testdata/creation_rules/prod/app.yaml",
+			Reason: `it matches creation_rules[0] (path_regex: "^prod/.*\\.yaml$") in testdata/creation_rules/.sops.yaml`,
+		},
+		{
+			Path:   "testdata/prod/app.yaml",
+			Reason: "it matches a requireEncrypted pattern",
+		},
+		{
+			Path:   "testdata/config/secrets.yaml",
+			Reason: "it matches a requireEncrypted pattern",
+		},
+	}
+
+	assert.Equal(t, expected, plaintextFiles)
+}
+
+func TestFindPlaintextFilesNearestConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	writeFile := func(name, content string) {
+		path := filepath.Join(tmpDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	writeFile(ConfigFileName, `
+creation_rules:
+  - path_regex: ^(prod|staging)/
+    age: age1yt3tfqlfrwdwx0z0ynwplcr6qxcxfaqycuprpmy89nr83ltx74tqdpszlw`)
+	writeFile("prod/"+ConfigFileName, `
+creation_rules:
+  - path_regex: ^secrets/
+    age: age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun`)
+
+	result := &FindResult{
+		ConfigFiles: []string{filepath.Join(tmpDir, ConfigFileName), filepath.Join(tmpDir, "prod", ConfigFileName)},
+		PlainFiles: []string{
+			filepath.Join(tmpDir, "prod", "values.yaml"),
+			filepath.Join(tmpDir, "prod", "secrets", "app.yaml"),
+			filepath.Join(tmpDir, "staging", "app.yaml"),
+			filepath.Join(tmpDir, "dev", "app.yaml"),
+		},
+	}
+
+	plaintextFiles, err := FindPlaintextFiles(result, nil)
+	require.NoError(t, err)
+
+	var paths []string
+	for _, file := range plaintextFiles {
+		paths = append(paths, file.Path)
+	}
+
+	// Only the nearest .sops.yaml file applies, so prod/values.yaml is not
+	// matched by the rule of the parent directory.
+	assert.Equal(t, []string{
+		filepath.Join(tmpDir, "prod", "secrets", "app.yaml"),
+		filepath.Join(tmpDir, "staging", "app.yaml"),
+	}, paths)
+}
+
+func TestFormatResolver(t *testing.T) {
+	resolver, err := NewFormatResolver(
+		map[string]string{".sops": "binary", ".json.sops": "json"},
+		[]string{"**/kubeconfig=yaml", "secrets/*.txt=dotenv", "certs/**=binary"},
+	)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		path     string
+		expected Format
+		known    bool
+	}{
+		{path: "app/secrets.yaml", expected: FormatYAML, known: true},
+		{path: "app/.env", expected: FormatDotenv, known: true},
+		{path: "app/terraform.tfvars.json.sops", expected: FormatJSON, known: true},
+		{path: "app/blob.sops", expected: FormatBinary, known: true},
+		{path: "clusters/prod/kubeconfig", expected: FormatYAML, known: true},
+		{path: "secrets/db.txt", expected: FormatDotenv, known: true},
+		{path: "certs/tls/key.pem", expected: FormatBinary, known: true},
+		{path: "app/certs/key.pem", known: false},
+		{path: "app/secret.enc", known: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			format, known := resolver.Resolve(tt.path)
+			assert.Equal(t, tt.known, known)
+			assert.Equal(t, tt.expected, format)
+		})
+	}
+
+	_, err = NewFormatResolver(map[string]string{".enc": "toml"}, nil)
+	assert.ErrorContains(t, err, `invalid format for extension ".enc"`)
+
+	_, err = NewFormatResolver(nil, []string{"kubeconfig"})
+	assert.ErrorContains(t, err, "expected <pattern>=<format>")
+}
+
+func TestFindFilesWithUnknownFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	copyFile := func(src, dst string) {
+		data, err := os.ReadFile(src)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, dst), data, 0o600))
+	}
+
+	copyFile("testdata/valid_sops_files/encrypted.yaml", "kubeconfig")
+	copyFile("testdata/valid_sops_files/encrypted.json", "secret.enc")
+	copyFile("testdata/valid_sops_files/encrypted.env", "secret.env.sops")
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "README"), []byte("Encrypt with sops.\n"), 0o600))
+
+	result, err := FindFiles(tmpDir, FindOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, result.MalformedFiles)
+	assert.Equal(t, []string{filepath.Join(tmpDir, "README")}, result.PlainFiles)
+
+	var paths []string
+	for _, file := range result.Files {
+		paths = append(paths, filepath.Base(file.Path))
+	}
+
+	assert.ElementsMatch(t, []string{"kubeconfig", "secret.enc", "secret.env.sops"}, paths)
+}
+
+func TestFindFilesFromList(t *testing.T) {
+	matcher, err := ignore.New(ignore.Options{Root: "testdata", Exclude: []string{"*.json"}})
+	assert.NoError(t, err)
+
+	result, err := FindFiles("testdata", FindOptions{
+		Ignore: matcher,
+		Files: []string{
+			"testdata/valid_sops_files/encrypted.yaml",
+			"testdata/valid_sops_files/encrypted.json",
+			"testdata/valid_sops_files",
+			"testdata/creation_rules/.sops.yaml",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, result.Files, 1)
+	assert.Equal(t, "testdata/valid_sops_files/encrypted.yaml", result.Files[0].Path)
+	assert.Empty(t, result.PlainFiles)
+	assert.Equal(t, []string{"testdata/creation_rules/.sops.yaml"}, result.ConfigFiles)
+
+	// .sops.yaml files in parent directories are found even if they are not
+	// listed.
+	result, err = FindFiles("testdata", FindOptions{
+		Ignore: matcher,
+		Files:  []string{"testdata/creation_rules/prod/app.yaml", "testdata/valid_sops_files/encrypted.yaml"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"testdata/creation_rules/.sops.yaml"}, result.ConfigFiles)
+}
+
+func TestFindFilesWalkOptions(t *testing.T) {
+	root := t.TempDir()
+
+	data, err := os.ReadFile("testdata/valid_sops_files/encrypted.yaml")
+	require.NoError(t, err)
+
+	for _, name := range []string{"a.yaml", "sub/b.yaml", "sub/deep/c.yaml", ".git/d.yaml"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), data, 0o600))
+	}
+
+	require.NoError(t, os.Symlink("sub", filepath.Join(root, "link")))
+	require.NoError(t, os.Symlink("..", filepath.Join(root, "sub", "loop")))
+
+	matcher, err := ignore.New(ignore.Options{Root: root})
+	require.NoError(t, err)
+
+	find := func(opts FindOptions) []string {
+		opts.Ignore = matcher
+
+		result, err := FindFiles(root, opts)
+		require.NoError(t, err)
+		assert.Empty(t, result.MalformedFiles)
+
+		var paths []string
+		for _, file := range result.Files {
+			rel, err := filepath.Rel(root, file.Path)
+			require.NoError(t, err)
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+
+		return paths
+	}
+
+	assert.Equal(t, []string{"a.yaml", "sub/b.yaml", "sub/deep/c.yaml"}, find(FindOptions{}))
+	assert.Equal(t, []string{"a.yaml"}, find(FindOptions{MaxDepth: 1}))
+	assert.Equal(t, []string{"a.yaml", "sub/b.yaml"}, find(FindOptions{MaxDepth: 2}))
+	assert.Equal(t, []string{
+		"a.yaml",
+		"link/b.yaml",
+		"link/deep/c.yaml",
+		"sub/b.yaml",
+		"sub/deep/c.yaml",
+	}, find(FindOptions{FollowSymlinks: true}))
+}
+
+func TestLocations(t *testing.T) {
+	recipient := "age1yt3tfqlfrwdwx0z0ynwplcr6qxcxfaqycuprpmy89nr83ltx74tqdpszlw"
+
+	tests := []struct {
+		path     string
+		metadata Region
+		entry    Region
+	}{
+		{path: "encrypted.yaml", metadata: Region{Line: 2, Column: 1}, entry: Region{Line: 8, Column: 11}},
+		{path: "encrypted.json", metadata: Region{Line: 3, Column: 2}, entry: Region{Line: 10, Column: 5}},
+		{path: "encrypted.ini", metadata: Region{Line: 4, Column: 1}, entry: Region{Line: 6, Column: 1}},
+		{path: "encrypted.env", metadata: Region{Line: 2, Column: 1}, entry: Region{Line: 2, Column: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path := filepath.Join("testdata/valid_sops_files", tt.path)
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+
+			file, err := ParseFile(path, data, nil)
+			require.NoError(t, err)
+			require.NotNil(t, file.Locations)
+
+			assert.Equal(t, tt.metadata, file.Locations.Metadata)
+			assert.Equal(t, map[string][]Region{recipient: {tt.entry}}, file.Locations.TrustAnchors)
+		})
+	}
+}
+
+func TestLocationsKeyGroups(t *testing.T) {
+	data := []byte(`data: ENC[AES256_GCM,data:Zm9v,type:str]
+sops:
+    age:
+        - recipient: age1top
+    key_groups:
+        - age:
+            - recipient: age1first
+            - recipient: age1second
+        - pgp:
+            - fp: FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4
+          age:
+            - recipient: age1first
+`)
+
+	keyGroups := [][]TrustAnchor{
+		{{ID: "age1first", Type: KeyTypeAge}, {ID: "age1second", Type: KeyTypeAge}},
+		{{ID: "FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4", Type: KeyTypePGP}, {ID: "age1first", Type: KeyTypeAge}},
+	}
+
+	locations := locate(data, FormatYAML, keyGroups)
+	require.NotNil(t, locations)
+
+	assert.Equal(t, Region{Line: 2, Column: 1}, locations.Metadata)
+	assert.Equal(t, map[string][]Region{
+		"age1first":  {{Line: 7, Column: 15}, {Line: 12, Column: 15}},
+		"age1second": {{Line: 8, Column: 15}},
+		"FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4": {{Line: 10, Column: 15}},
+	}, locations.TrustAnchors)
+
+	assert.Nil(t, locate([]byte("foo: ["), FormatYAML, keyGroups))
+}
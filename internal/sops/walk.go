@@ -0,0 +1,116 @@
+package sops
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/Bonial-International-GmbH/sops-check/internal/ignore"
+)
+
+// walker walks a directory tree in lexical order and emits the paths of all
+// files which are not ignored. Ignored directories are not descended into.
+type walker struct {
+	ignore         *ignore.Matcher
+	maxDepth       int
+	followSymlinks bool
+	emit           func(string)
+}
+
+// walk walks the directory tree at root. If root is a file, only root itself
+// is emitted.
+func (w *walker) walk(root string) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return w.emitFile(root)
+	}
+
+	return w.walkDir(root, 1, nil)
+}
+
+// walkDir walks dir, which is depth levels below the root. If symlinks are
+// followed, ancestors contains the resolved paths of the directories above
+// dir, which is used to detect symlink loops.
+func (w *walker) walkDir(dir string, depth int, ancestors []string) error {
+	if w.followSymlinks {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return err
+		}
+
+		// Symlinks pointing to one of their parent directories would
+		// otherwise be followed forever.
+		if slices.Contains(ancestors, resolved) {
+			return nil
+		}
+
+		ancestors = append(ancestors, resolved)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+
+		isDir := entry.IsDir()
+		if entry.Type()&fs.ModeSymlink != 0 {
+			// Broken symlinks are treated like files, so that they are
+			// reported when reading them fails.
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				if !w.followSymlinks {
+					continue
+				}
+
+				isDir = true
+			}
+		}
+
+		if !isDir {
+			if err := w.emitFile(path); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if w.maxDepth > 0 && depth >= w.maxDepth {
+			continue
+		}
+
+		ignored, err := w.ignore.Match(path, true)
+		if err != nil {
+			return err
+		}
+
+		if ignored {
+			continue
+		}
+
+		if err := w.walkDir(path, depth+1, ancestors); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *walker) emitFile(path string) error {
+	ignored, err := w.ignore.Match(path, false)
+	if err != nil {
+		return err
+	}
+
+	if !ignored {
+		w.emit(path)
+	}
+
+	return nil
+}
@@ -6,17 +6,25 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/Bonial-International-GmbH/sops-check/internal/cli"
 	"github.com/Bonial-International-GmbH/sops-check/internal/config"
+	"github.com/Bonial-International-GmbH/sops-check/internal/git"
+	"github.com/Bonial-International-GmbH/sops-check/internal/ignore"
+	"github.com/Bonial-International-GmbH/sops-check/internal/parallel"
+	"github.com/Bonial-International-GmbH/sops-check/internal/report"
 	"github.com/Bonial-International-GmbH/sops-check/internal/rules"
 	"github.com/Bonial-International-GmbH/sops-check/internal/sops"
 	"github.com/Bonial-International-GmbH/sops-check/internal/stringutils"
 	"github.com/owenrumney/go-sarif/v2/sarif"
-	ignore "github.com/sabhiram/go-gitignore"
 )
 
+// stdin is the reader of the file checked when passing - as path.
+var stdin io.Reader = os.Stdin
+
 func main() {
 	if err := run(os.Stdout, os.Args[1:]); err != nil {
 		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
@@ -27,21 +35,12 @@ func main() {
 func run(w io.Writer, commandLine []string) error {
 	logger := slog.New(slog.NewTextHandler(w, nil))
 	slog.SetDefault(logger)
-	var ignoreObjects []*ignore.GitIgnore
 
 	args, err := cli.ParseArgs(commandLine)
 	if err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
 
-	for _, ignoreFile := range args.IgnoreFilePath {
-		ignoreObject, err := ignore.CompileIgnoreFile(ignoreFile)
-		if err != nil {
-			return fmt.Errorf("failed to process ignore file %s : %w", ignoreFile, err)
-		}
-		ignoreObjects = append(ignoreObjects, ignoreObject)
-	}
-
 	cfg, err := config.Load(args.ConfigPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -51,99 +50,717 @@ func run(w io.Writer, commandLine []string) error {
 		return fmt.Errorf("failed to load config file: %w", err)
 	}
 
-	rootRule, err := rules.Compile(cfg.Rules)
+	if args.ExplainIgnore != "" {
+		return explainIgnore(w, cfg, args)
+	}
+
+	rootRule, err := rules.Compile(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to compile rules: %w", err)
 	}
 
-	files, err := sops.FindFiles(args.CheckPath, ignoreObjects)
+	formats, err := sops.NewFormatResolver(cfg.Formats, args.FormatOverrides)
 	if err != nil {
-		return fmt.Errorf("failed to find sops files: %w", err)
+		return err
 	}
 
-	if err := checkFiles(w, rootRule, cfg, files, args); err != nil {
+	var warningFiles []string
+
+	if args.History != nil {
+		warningFiles, err = checkHistory(w, rootRule, cfg, formats, args)
+	} else {
+		warningFiles, err = checkPaths(w, rootRule, cfg, formats, args)
+	}
+
+	if err != nil {
 		return err
 	}
 
+	w = textOutput(w, args)
+
+	if len(warningFiles) > 0 {
+		fmt.Fprintf(w, "⚠️ No errors found, but found warnings in %d files:%s\n", len(warningFiles), formatFileList(warningFiles))
+		return nil
+	}
+
 	fmt.Fprintln(w, "✅ No issues found.")
 
 	return nil
 }
 
-// sarifRun compiles all the results and creates a Sarif run.
-func sarifRun(results []rules.SarifResult) *sarif.Run {
+// newIgnoreMatcher creates the matcher for ignored files within the check
+// path root.
+func newIgnoreMatcher(cfg *config.Config, args *cli.Args, root string) (*ignore.Matcher, error) {
+	return ignore.New(ignore.Options{
+		Root:        root,
+		IgnoreFiles: args.IgnoreFilePath,
+		Exclude:     cfg.Exclude,
+		NoDefaults:  args.NoDefaultIgnores,
+	})
+}
+
+// explainIgnore prints whether and why the path passed via --explain-ignore is
+// ignored, using the ignore patterns of the check path containing it.
+func explainIgnore(w io.Writer, cfg *config.Config, args *cli.Args) error {
+	root := "."
+
+	dirs, _, _ := splitCheckPaths(args.CheckPaths)
+
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(dir, args.ExplainIgnore)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			root = dir
+			break
+		}
+	}
+
+	matcher, err := newIgnoreMatcher(cfg, args, root)
+	if err != nil {
+		return err
+	}
+
+	explanation, err := matcher.Explain(args.ExplainIgnore)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%s is %s\n", args.ExplainIgnore, explanation)
+
+	return nil
+}
+
+// splitCheckPaths splits the check paths into directories, files and whether
+// to read a file from stdin. Paths which do not exist are treated as
+// directories, so that walking them reports the error.
+func splitCheckPaths(checkPaths []string) (dirs, files []string, readStdin bool) {
+	for _, checkPath := range checkPaths {
+		if checkPath == cli.StdinPath {
+			readStdin = true
+			continue
+		}
+
+		if info, err := os.Stat(checkPath); err == nil && !info.IsDir() {
+			files = append(files, checkPath)
+		} else {
+			dirs = append(dirs, checkPath)
+		}
+	}
+
+	return dirs, files, readStdin
+}
+
+// checkPaths checks all files found in the directory trees at the check paths,
+// or only those changed since a git ref if requested, as well as files passed
+// explicitly and the file read from stdin. The results of all check paths are
+// combined into a single report.
+func checkPaths(w io.Writer, rootRule rules.Rule, cfg *config.Config, formats *sops.FormatResolver, args *cli.Args) ([]string, error) {
+	found := &sops.FindResult{}
+
+	dirs, files, readStdin := splitCheckPaths(args.CheckPaths)
+
+	for _, dir := range dirs {
+		result, err := findFiles(cfg, formats, args, dir, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		found.Append(result)
+	}
+
+	// Explicit files bypass the directory walk, but ignore patterns of the
+	// working directory still apply.
+	if len(files) > 0 {
+		result, err := findFiles(cfg, formats, args, ".", files)
+		if err != nil {
+			return nil, err
+		}
+
+		found.Append(result)
+	}
+
+	if readStdin {
+		result, err := readStdinFile(cfg, formats, args)
+		if err != nil {
+			return nil, err
+		}
+
+		found.Append(result)
+	}
+
+	return checkFiles(w, rootRule, cfg, found, args)
+}
+
+// findFiles finds all files in the directory tree at root, or only those
+// changed since a git ref if requested. If files is not nil, only those files
+// are checked instead.
+func findFiles(cfg *config.Config, formats *sops.FormatResolver, args *cli.Args, root string, files []string) (*sops.FindResult, error) {
+	matcher, err := newIgnoreMatcher(cfg, args, root)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := sops.FindOptions{
+		Ignore:         matcher,
+		Formats:        formats,
+		MaxDepth:       args.MaxDepth,
+		FollowSymlinks: args.FollowSymlinks,
+		Jobs:           args.Jobs,
+		Files:          files,
+	}
+
+	if files == nil && args.ChangedSince != "" {
+		changed, err := git.ChangedFiles(root, args.ChangedSince)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine files changed since %s: %w", args.ChangedSince, err)
+		}
+
+		// A non-nil empty list means that no files changed.
+		opts.Files = append([]string{}, changed...)
+	}
+
+	found, err := sops.FindFiles(root, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sops files: %w", err)
+	}
+
+	return found, nil
+}
+
+// readStdinFile reads a single file from stdin. Its format is taken from
+// --stdin-format, or determined from --stdin-filename otherwise. The
+// .sops.yaml files in the parent directories of --stdin-filename, up to the
+// working directory, are found as well.
+func readStdinFile(cfg *config.Config, formats *sops.FormatResolver, args *cli.Args) (*sops.FindResult, error) {
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from stdin: %w", err)
+	}
+
+	var file *sops.File
+
+	if args.StdinFormat != "" {
+		file, err = sops.ParseFileAs(args.StdinFilename, data, sops.Format(args.StdinFormat))
+	} else {
+		file, err = sops.ParseFile(args.StdinFilename, data, formats)
+	}
+
+	result := &sops.FindResult{}
+
+	switch {
+	case err != nil:
+		result.MalformedFiles = append(result.MalformedFiles, sops.MalformedFile{Path: args.StdinFilename, Err: err})
+	case file == nil:
+		result.PlainFiles = append(result.PlainFiles, args.StdinFilename)
+	default:
+		result.Files = append(result.Files, *file)
+	}
+
+	matcher, err := newIgnoreMatcher(cfg, args, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	result.ConfigFiles, err = sops.FindConfigFiles(".", []string{args.StdinFilename}, matcher)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sops config files: %w", err)
+	}
+
+	return result, nil
+}
+
+// sarifRun compiles all the results and creates a Sarif run. Every rule
+// nested within rootRule is described in the run, even if it has no results.
+func sarifRun(rootRule rules.Rule, results []rules.SarifResult) *sarif.Run {
 	run := sarif.NewRunWithInformationURI("sops-check", "sops-check")
 
+	rules.Walk(rootRule, func(rule rules.Rule) {
+		// The root rule is not part of the configuration.
+		if meta := rule.Meta(); meta.ID != "" {
+			addSarifRule(run, meta.ID, meta.Description, meta.URL)
+		}
+	})
+
 	for _, r := range results {
-		run.AddRule(r.RuleID).
-			WithDescription(r.Description)
+		addSarifRule(run, r.RuleID, r.Description, r.HelpURI)
 
-		run.CreateResultForRule(r.RuleID).
+		result := run.CreateResultForRule(r.RuleID).
 			WithKind(r.Kind).
 			WithLevel(strings.ToLower(r.Evaluation)).
-			WithMessage(sarif.NewTextMessage(r.Message)).
-			AddLocation(
-				sarif.NewLocationWithPhysicalLocation(
-					sarif.NewPhysicalLocation().
-						WithArtifactLocation(
-							sarif.NewSimpleArtifactLocation(r.File),
-						),
-				),
-			)
+			WithMessage(sarif.NewTextMessage(r.Message))
+
+		if len(r.Regions) == 0 {
+			result.AddLocation(sarifLocation(r.File, nil))
+		}
+
+		for _, region := range r.Regions {
+			result.AddLocation(sarifLocation(r.File,
+				sarif.NewRegion().WithStartLine(region.Line).WithStartColumn(region.Column)))
+		}
 	}
 	return run
 }
 
-func checkFiles(w io.Writer, rootRule rules.Rule, cfg *config.Config, files []sops.File, args *cli.Args) error {
-	var problematicFiles []string
-	report, _ := sarif.New(sarif.Version210)
-	var results []rules.SarifResult
+// addSarifRule adds a rule with the given ID to the SARIF run, unless it is
+// already present.
+func addSarifRule(run *sarif.Run, id, description, helpURI string) {
+	rule := run.AddRule(id).WithDescription(description)
 
-	for _, file := range files {
-		result := checkFile(w, rootRule, &file)
-
-		// Rules will evaluate to success, even in the presence of excess trust
-		// anchors that did not match any rule.
-		//
-		// The default behaviour is to consider files with unmatched trust
-		// anchors as problematic (and thus fail the check), unless
-		// `allowUnmatched` is explicitly set to `true` in the configuration.
-		if !result.Success || (result.Unmatched.Size() > 0 && !cfg.AllowUnmatched) {
+	if helpURI != "" {
+		rule.WithHelpURI(helpURI)
+	}
+}
+
+// sarifLocation creates a SARIF location pointing at file, and at region
+// within it unless region is nil.
+func sarifLocation(file string, region *sarif.Region) *sarif.Location {
+	location := sarif.NewPhysicalLocation().
+		WithArtifactLocation(sarif.NewSimpleArtifactLocation(file))
+
+	if region != nil {
+		location.WithRegion(region)
+	}
+
+	return sarif.NewLocationWithPhysicalLocation(location)
+}
+
+// checkFiles evaluates the rules for all files and for the creation rules of
+// all .sops.yaml files, reports malformed files and writes the results. It
+// returns an error if any of the files has issues, and the list of files that
+// only have warnings otherwise.
+func checkFiles(w io.Writer, rootRule rules.Rule, cfg *config.Config, found *sops.FindResult, args *cli.Args) ([]string, error) {
+	var problematicFiles, warningFiles []string
+	var rep report.Report
+
+	text := textOutput(w, args)
+
+	// Files outside of the top-level path scope are not checked at all.
+	scope := rules.NewScope(cfg.Paths, cfg.ExcludePaths)
+
+	checkCreationRules := args.CheckCreationRules || cfg.CheckCreationRules
+
+	now := evalTime(args)
+
+	var inScope []sops.File
+
+	for _, file := range found.Files {
+		if scope.Matches(file.Path) {
+			inScope = append(inScope, file)
+		}
+	}
+
+	// Files are evaluated concurrently, but their output is buffered and
+	// written in order, so that it is deterministic.
+	checks := parallel.MapSlice(args.Jobs, inScope, func(file sops.File) fileCheck {
+		var check fileCheck
+		var output strings.Builder
+
+		check.result = checkFile(&output, rootRule, &file, now)
+
+		if checkCreationRules {
+			check.drift = checkCreationRule(&output, &file)
+		}
+
+		check.output = output.String()
+
+		return check
+	})
+
+	for i, check := range checks {
+		file := inScope[i]
+		result := check.result
+		drift := check.drift
+
+		fmt.Fprint(text, check.output)
+
+		entry := report.File{
+			Path:         file.Path,
+			Status:       report.StatusPass,
+			Result:       &result,
+			SarifResults: result.SarifResults(file.Path, file.Locations, cfg.AllowUnmatched),
+		}
+
+		// Drift from the creation rules in .sops.yaml always fails the check.
+		switch {
+		case isProblematic(result, cfg) || drift != nil:
 			problematicFiles = append(problematicFiles, file.Path)
-			sarifResult := result.SarifResult(file.Path, cfg.AllowUnmatched)
-			results = append(results, sarifResult)
+			entry.Status = report.StatusFail
+		case result.Severity() != "":
+			warningFiles = append(warningFiles, file.Path)
+			entry.Status = report.StatusWarning
+		}
+
+		if drift != nil {
+			entry.Issues = append(entry.Issues, drift.Message)
+			entry.SarifResults = append(entry.SarifResults, *drift)
 		}
+
+		rep.Add(entry)
 	}
 
-	if args.SarifReportPath != "" {
-		run := sarifRun(results)
-		report.AddRun(run)
-		if err := report.WriteFile(args.SarifReportPath); err != nil {
-			return fmt.Errorf("could not write the report to %s: %w", args.SarifReportPath, err)
+	var loadIssues []rules.SarifResult
+
+	for _, file := range found.MalformedFiles {
+		if scope.Matches(file.Path) {
+			loadIssues = append(loadIssues, checkMalformedFile(text, &file, args.FailOnMalformed))
+		}
+	}
+
+	for _, file := range found.UnreadableFiles {
+		if scope.Matches(file.Path) {
+			loadIssues = append(loadIssues, checkUnreadableFile(text, &file, args.FailOnMalformed))
+		}
+	}
+
+	for _, issue := range loadIssues {
+		status := report.StatusWarning
+
+		// Malformed and unreadable files can only fail the check if
+		// explicitly requested.
+		if args.FailOnMalformed {
+			problematicFiles = append(problematicFiles, issue.File)
+			status = report.StatusFail
+		} else {
+			warningFiles = append(warningFiles, issue.File)
+		}
+
+		rep.Add(issueFile(status, issue))
+	}
+
+	plaintextFiles, err := sops.FindPlaintextFiles(found, cfg.RequireEncrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find plaintext files: %w", err)
+	}
+
+	for _, file := range plaintextFiles {
+		if !scope.Matches(file.Path) {
+			continue
+		}
+
+		problematicFiles = append(problematicFiles, file.Path)
+		rep.Add(issueFile(report.StatusFail, checkPlaintextFile(text, &file)))
+	}
+
+	for _, configFile := range found.ConfigFiles {
+		if args.NoLintCreationRules || !scope.Matches(configFile) {
+			continue
+		}
+
+		creationRules, err := sops.LoadCreationRules(configFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load creation rules: %w", err)
+		}
+
+		for _, creationRule := range creationRules {
+			name := fmt.Sprintf("%s %s", configFile, creationRule.String())
+			result := checkCreationRuleAnchors(text, rootRule, name, &creationRule, now)
+
+			entry := report.File{
+				Path:         configFile,
+				CreationRule: creationRule.String(),
+				Status:       report.StatusPass,
+				Result:       &result,
+			}
+
+			switch {
+			case isProblematic(result, cfg):
+				problematicFiles = append(problematicFiles, name)
+				entry.Status = report.StatusFail
+			case result.Severity() != "":
+				warningFiles = append(warningFiles, name)
+				entry.Status = report.StatusWarning
+			}
+
+			for _, sarifResult := range result.SarifResults(configFile, nil, cfg.AllowUnmatched) {
+				sarifResult.Message = fmt.Sprintf("%s:\n%s", creationRule.String(), sarifResult.Message)
+				entry.SarifResults = append(entry.SarifResults, sarifResult)
+			}
+
+			rep.Add(entry)
 		}
 	}
 
+	if err := writeReports(w, rootRule, &rep, args); err != nil {
+		return nil, err
+	}
+
 	if len(problematicFiles) > 0 {
-		var sb strings.Builder
+		return nil, fmt.Errorf("found %d files with issues:%s", len(problematicFiles), formatFileList(problematicFiles))
+	}
+
+	return warningFiles, nil
+}
+
+// evalTime returns the point in time at which age-based rules are evaluated
+// for all files.
+func evalTime(args *cli.Args) time.Time {
+	if args.Now.IsZero() {
+		return time.Now()
+	}
+
+	return args.Now
+}
+
+// writeReports writes the report to w in the format requested via --output,
+// and to the SARIF report and all other report files.
+func writeReports(w io.Writer, rootRule rules.Rule, rep *report.Report, args *cli.Args) error {
+	var err error
 
-		for _, file := range problematicFiles {
-			fmt.Fprintf(&sb, "\n  - %s", file)
+	switch args.Output {
+	case cli.OutputJSON:
+		err = rep.WriteJSON(w)
+	case cli.OutputGitHub:
+		err = rep.WriteGitHub(w)
+	case cli.OutputGitLabCodeQuality:
+		err = rep.WriteCodeQuality(w)
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not write the report: %w", err)
+	}
+
+	reports := args.Reports
+
+	if args.SarifReportPath != "" {
+		reports = append([]cli.Report{{Format: cli.ReportSARIF, Path: args.SarifReportPath}}, reports...)
+	}
+
+	for _, r := range reports {
+		if err := writeReportFile(r, rootRule, rep); err != nil {
+			return fmt.Errorf("could not write the report to %s: %w", r.Path, err)
 		}
-		return fmt.Errorf("found %d files with issues:%s", len(problematicFiles), sb.String())
 	}
 
 	return nil
 }
 
-func checkFile(w io.Writer, rootRule rules.Rule, file *sops.File) rules.EvalResult {
-	ctx := rules.NewEvalContext(file.ExtractKeys())
+// writeReportFile writes the report in the format requested by r to its path.
+func writeReportFile(r cli.Report, rootRule rules.Rule, rep *report.Report) error {
+	file, err := os.Create(r.Path)
+	if err != nil {
+		return err
+	}
+
+	switch r.Format {
+	case cli.ReportJSON:
+		err = rep.WriteJSON(file)
+	case cli.ReportSARIF:
+		sarifReport, _ := sarif.New(sarif.Version210)
+		sarifReport.AddRun(sarifRun(rootRule, rep.SarifResults()))
+		err = sarifReport.PrettyWrite(file)
+	case cli.ReportJUnit:
+		err = rep.WriteJUnit(file)
+	case cli.ReportGitLabCodeQuality:
+		err = rep.WriteCodeQuality(file)
+	default:
+		err = fmt.Errorf("unknown report format %q", r.Format)
+	}
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// textOutput returns the writer for the human readable output, which is
+// discarded if a machine-readable report is written to w instead.
+func textOutput(w io.Writer, args *cli.Args) io.Writer {
+	if args.Output == cli.OutputJSON || args.Output == cli.OutputGitLabCodeQuality {
+		return io.Discard
+	}
+
+	return w
+}
+
+// issueFile creates the report entry of a file with a single issue found by a
+// check other than the rules.
+func issueFile(status report.Status, result rules.SarifResult) report.File {
+	return report.File{
+		Path:         result.File,
+		Status:       status,
+		Issues:       []string{result.Message},
+		SarifResults: []rules.SarifResult{result},
+	}
+}
+
+// fileCheck holds the outcome of checking a single SOPS file.
+type fileCheck struct {
+	// output contains everything that was written while checking the file.
+	output string
+	result rules.EvalResult
+	drift  *rules.SarifResult
+}
+
+// isProblematic reports whether result fails the check.
+//
+// Rules will evaluate to success, even in the presence of excess trust anchors
+// that did not match any rule.
+//
+// The default behaviour is to consider files with unmatched trust anchors as
+// problematic (and thus fail the check), unless `allowUnmatched` is explicitly
+// set to `true` in the configuration.
+//
+// Failures of rules with a severity other than `error` are reported, but do
+// not fail the check.
+func isProblematic(result rules.EvalResult, cfg *config.Config) bool {
+	return !result.Success || (result.Unmatched.Size() > 0 && !cfg.AllowUnmatched)
+}
+
+// formatFileList formats a list of file paths as an indented bullet list.
+func formatFileList(files []string) string {
+	var sb strings.Builder
+
+	for _, file := range files {
+		fmt.Fprintf(&sb, "\n  - %s", file)
+	}
+
+	return sb.String()
+}
+
+// checkCreationRule compares the key groups of file with those of the matching
+// creation rule in the nearest .sops.yaml file. If they differ, the differences
+// are written to w and returned as a SARIF result. Returns nil otherwise.
+func checkCreationRule(w io.Writer, file *sops.File) *rules.SarifResult {
+	var message string
+
+	rule, err := sops.FindCreationRule(file.Path)
+	switch {
+	case err != nil:
+		message = fmt.Sprintf("[creationRules] %v\n", err)
+	case rule == nil:
+		return nil
+	default:
+		drift := file.CreationRuleDrift(rule)
+		if len(drift) == 0 {
+			return nil
+		}
+
+		message = fmt.Sprintf("[creationRules] Key groups differ from the matching creation rule in %s:%s\n",
+			rule.ConfigPath, formatFileList(drift))
+	}
+
+	fmt.Fprintf(w, "Found drift from creation rules in %s:\n\n", file.Path)
+	fmt.Fprintln(w, stringutils.Indent(message, 4, true))
+
+	return &rules.SarifResult{
+		RuleID:      "creationRules",
+		Evaluation:  string(rules.SeverityError),
+		Kind:        "fail",
+		Message:     message,
+		Description: "Key groups must match the creation rules in .sops.yaml",
+		File:        file.Path,
+	}
+}
+
+// checkMalformedFile writes the error encountered while loading file to w and
+// returns it as a SARIF result.
+func checkMalformedFile(w io.Writer, file *sops.MalformedFile, fail bool) rules.SarifResult {
+	severity, label := loadIssueSeverity(fail)
+	message := fmt.Sprintf("[malformedFile] %sFailed to load SOPS file: %v\n", label, file.Err)
+
+	fmt.Fprintf(w, "Found malformed SOPS file %s:\n\n", file.Path)
+	fmt.Fprintln(w, stringutils.Indent(message, 4, true))
+
+	return rules.SarifResult{
+		RuleID:      "malformedFile",
+		Evaluation:  string(severity),
+		Kind:        "fail",
+		Message:     message,
+		Description: "Files containing SOPS metadata must be valid SOPS files",
+		File:        file.Path,
+	}
+}
+
+// checkUnreadableFile writes the error encountered while reading file to w and
+// returns it as a SARIF result.
+func checkUnreadableFile(w io.Writer, file *sops.UnreadableFile, fail bool) rules.SarifResult {
+	severity, label := loadIssueSeverity(fail)
+	message := fmt.Sprintf("[unreadableFile] %sFailed to read file: %v\n", label, file.Err)
+
+	fmt.Fprintf(w, "Found unreadable file %s:\n\n", file.Path)
+	fmt.Fprintln(w, stringutils.Indent(message, 4, true))
+
+	return rules.SarifResult{
+		RuleID:      "unreadableFile",
+		Evaluation:  string(severity),
+		Kind:        "fail",
+		Message:     message,
+		Description: "Files must be readable to check whether they are SOPS files",
+		File:        file.Path,
+	}
+}
+
+// loadIssueSeverity returns the severity of malformed and unreadable files and
+// the label prepended to their messages, depending on whether they fail the
+// check.
+func loadIssueSeverity(fail bool) (rules.Severity, string) {
+	if fail {
+		return rules.SeverityError, ""
+	}
+
+	return rules.SeverityWarning, "(warning) "
+}
+
+// checkPlaintextFile writes why file is expected to be encrypted to w and
+// returns it as a SARIF result.
+func checkPlaintextFile(w io.Writer, file *sops.PlaintextFile) rules.SarifResult {
+	message := fmt.Sprintf("[requireEncrypted] Expected an encrypted SOPS file, because %s, but found no SOPS metadata.\n", file.Reason)
+
+	fmt.Fprintf(w, "Found unencrypted file %s:\n\n", file.Path)
+	fmt.Fprintln(w, stringutils.Indent(message, 4, true))
+
+	return rules.SarifResult{
+		RuleID:      "requireEncrypted",
+		Evaluation:  string(rules.SeverityError),
+		Kind:        "fail",
+		Message:     message,
+		Description: "Files matching requireEncrypted patterns or creation rules in .sops.yaml must be encrypted",
+		File:        file.Path,
+	}
+}
+
+func checkFile(w io.Writer, rootRule rules.Rule, file *sops.File, now time.Time) rules.EvalResult {
+	result := evalFile(rootRule, file, now)
+
+	writeResult(w, file.Path, result)
+
+	return result
+}
+
+// evalFile evaluates the rules against the trust anchors and metadata of file.
+func evalFile(rootRule rules.Rule, file *sops.File, now time.Time) rules.EvalResult {
+	ctx := rules.NewEvalContextFromKeyGroups(file.KeyGroups())
+	ctx.FilePath = file.Path
+	ctx.Metadata = &file.Metadata
+	ctx.Now = now
+
+	return rootRule.Eval(ctx)
+}
+
+// checkCreationRuleAnchors evaluates the rules against the trust anchors that
+// SOPS would use for new files matching the creation rule, so that policy
+// violations are detected before anything is encrypted with it. The paths of
+// these files and the SOPS version used to encrypt them are unknown, so rules
+// with a path scope and version requirements do not apply.
+func checkCreationRuleAnchors(w io.Writer, rootRule rules.Rule, name string, rule *sops.CreationRule, now time.Time) rules.EvalResult {
+	ctx := rules.NewEvalContextFromKeyGroups(rule.KeyGroups)
+	ctx.Metadata = rule.Metadata(now)
+	ctx.UnknownVersion = true
+	ctx.Now = now
 	result := rootRule.Eval(ctx)
+
+	writeResult(w, name, result)
+
+	return result
+}
+
+// writeResult writes the formatted result to w if it has anything to report.
+func writeResult(w io.Writer, name string, result rules.EvalResult) {
 	formattedResult := result.Format()
 
 	if formattedResult != "" {
-		fmt.Fprintf(w, "Found issues in %s:\n\n", file.Path)
+		fmt.Fprintf(w, "Found issues in %s:\n\n", name)
 		fmt.Fprintln(w, stringutils.Indent(formattedResult, 4, true))
 	}
-
-	return result
 }
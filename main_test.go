@@ -1,8 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -13,6 +17,9 @@ import (
 )
 
 func TestRun(t *testing.T) {
+	// The output format is detected from the CI environment.
+	t.Setenv("GITHUB_ACTIONS", "")
+
 	t.Run("allow unmatched", func(t *testing.T) {
 		cfg := &config.Config{AllowUnmatched: true}
 
@@ -111,6 +118,662 @@ func TestRun(t *testing.T) {
 		assert.Equal(t, createdSarif, validSarif)
 	})
 
+	t.Run("warnings", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		cfg := &config.Config{
+			AllowUnmatched: true,
+			Rules: []config.Rule{
+				{
+					ID:       "team-key",
+					URL:      "https://example.com/team-key",
+					Severity: "warning",
+					Match:    "this-is-trust-anchor-a",
+				},
+			},
+		}
+
+		output, err := runWithConfig(t, cfg, tmpDir+"/warnings.sarif")
+		require.NoError(t, err)
+		assert.Contains(t, output, "[match] (warning) More details: https://example.com/team-key")
+		assert.Contains(t, output, "Expected trust anchor \"this-is-trust-anchor-a\" was not found.")
+		assert.Contains(t, output, "No errors found, but found warnings in 5 files")
+
+		createdSarif, err := os.ReadFile(tmpDir + "/warnings.sarif")
+		require.NoError(t, err)
+		assert.Contains(t, string(createdSarif), `"level": "warning"`)
+		assert.Contains(t, string(createdSarif), `"ruleId": "team-key"`)
+		assert.Contains(t, string(createdSarif), `"helpUri": "https://example.com/team-key"`)
+	})
+
+	t.Run("files outside of path scope", func(t *testing.T) {
+		cfg := &config.Config{
+			AllowUnmatched: false,
+			ExcludePaths:   []string{"valid_sops_files/"},
+		}
+
+		output, err := runWithConfig(t, cfg)
+		require.NoError(t, err)
+		assert.NotContains(t, output, "Found issues in")
+	})
+
+	t.Run("creation rule drift", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		data, err := os.ReadFile("internal/sops/testdata/valid_sops_files/encrypted.yaml")
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "encrypted.yaml"), data, 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, ".sops.yaml"), []byte(`
+creation_rules:
+  - age: age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun`), 0o600))
+
+		configPath := filepath.Join(tmpDir, ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("allowUnmatched: true\nrules: []\n"), 0o600))
+
+		var sb strings.Builder
+		err = run(&sb, []string{"--config", configPath, "--check-creation-rules", tmpDir})
+		require.Error(t, err)
+		assert.Contains(t, sb.String(), "Found drift from creation rules in")
+		assert.Contains(t, sb.String(), "Key group 1 is missing trust anchors: age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun")
+
+		// Files without a matching creation rule have nothing to drift from.
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, ".sops.yaml"), []byte(`
+creation_rules:
+  - path_regex: ^prod/
+    age: age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun`), 0o600))
+
+		sb.Reset()
+		require.NoError(t, run(&sb, []string{"--config", configPath, "--check-creation-rules", tmpDir}), sb.String())
+		assert.NotContains(t, sb.String(), "creation rules")
+	})
+
+	t.Run("creation rules violating the policy", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		sarifPath := filepath.Join(t.TempDir(), "creation_rules.sarif")
+
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, ".sops.yaml"), []byte(`
+creation_rules:
+  - path_regex: ^prod/
+    key_groups:
+      - kms:
+          - arn: arn:aws:kms:us-east-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab
+  - age: age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun`), 0o600))
+
+		configPath := filepath.Join(tmpDir, ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("rules:\n  - matchType: kms\n"), 0o600))
+
+		var sb strings.Builder
+		err := run(&sb, []string{"--config", configPath, "--sarif-report-path", sarifPath, tmpDir})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "found 1 files with issues")
+		assert.NotContains(t, sb.String(), `creation_rules[0]`)
+		assert.Contains(t, sb.String(), "Found issues in "+filepath.Join(tmpDir, ".sops.yaml")+" creation_rules[1] (matches all files):")
+		assert.Contains(t, sb.String(), `[matchType] Trust anchor of type "kms" was not found.`)
+
+		createdSarif, err := os.ReadFile(sarifPath)
+		require.NoError(t, err)
+		assert.Contains(t, string(createdSarif), `creation_rules[1] (matches all files):`)
+		assert.Contains(t, string(createdSarif), filepath.Join(tmpDir, ".sops.yaml"))
+	})
+
+	t.Run("creation rules with version requirements", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, ".sops.yaml"), []byte(`
+creation_rules:
+  - age: age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun`), 0o600))
+
+		configPath := filepath.Join(tmpDir, ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("rules:\n  - matchType: age\n  - metadata:\n      minVersion: 3.8.0\n"), 0o600))
+
+		var sb strings.Builder
+		require.NoError(t, run(&sb, []string{"--config", configPath, tmpDir}), sb.String())
+		assert.NotContains(t, sb.String(), "creation_rules")
+	})
+
+	t.Run("creation rules with path-scoped rules", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, ".sops.yaml"), []byte(`
+creation_rules:
+  - path_regex: envs/production/.*
+    key_groups:
+      - kms:
+          - arn: arn:aws:kms:us-east-2:111122223333:key/production
+        age:
+          - age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun
+  - age: age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun`), 0o600))
+
+		configPath := filepath.Join(tmpDir, ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte(`
+rules:
+  - matchType: age
+  - match: arn:aws:kms:us-east-2:111122223333:key/production
+    paths: [envs/production/**]
+  - not:
+      match: arn:aws:kms:us-east-2:111122223333:key/production
+    excludePaths: [envs/production/**]
+`), 0o600))
+
+		var sb strings.Builder
+		require.NoError(t, run(&sb, []string{"--config", configPath, tmpDir}), sb.String())
+		assert.NotContains(t, sb.String(), "creation_rules")
+
+		require.NoError(t, os.WriteFile(configPath, []byte("rules:\n  - matchType: kms\n"), 0o600))
+
+		sb.Reset()
+		require.Error(t, run(&sb, []string{"--config", configPath, tmpDir}))
+
+		sb.Reset()
+		require.NoError(t, run(&sb, []string{"--config", configPath, "--no-lint-creation-rules", tmpDir}))
+		assert.NotContains(t, sb.String(), "creation_rules")
+	})
+
+	t.Run("malformed files", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		data, err := os.ReadFile("internal/sops/testdata/invalid_sops_files/corrupt_metadata.yaml")
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "corrupt.yaml"), data, 0o600))
+
+		configPath := filepath.Join(t.TempDir(), ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("rules: []\n"), 0o600))
+
+		var sb strings.Builder
+		err = run(&sb, []string{"--config", configPath, tmpDir})
+		require.NoError(t, err)
+		assert.Contains(t, sb.String(), "Found malformed SOPS file "+filepath.Join(tmpDir, "corrupt.yaml"))
+		assert.Contains(t, sb.String(), "[malformedFile] (warning) Failed to load SOPS file: invalid sops metadata")
+		assert.Contains(t, sb.String(), "No errors found, but found warnings in 1 files")
+
+		sarifPath := filepath.Join(t.TempDir(), "malformed.sarif")
+
+		sb.Reset()
+		err = run(&sb, []string{"--config", configPath, "--fail-on-malformed", "--sarif-report-path", sarifPath, tmpDir})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "found 1 files with issues")
+
+		createdSarif, err := os.ReadFile(sarifPath)
+		require.NoError(t, err)
+		assert.Contains(t, string(createdSarif), `"ruleId": "malformedFile"`)
+		assert.Contains(t, string(createdSarif), `"level": "error"`)
+	})
+
+	t.Run("unreadable files", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		require.NoError(t, os.Symlink("missing.yaml", filepath.Join(tmpDir, "broken.yaml")))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "notes.yaml"), []byte("about: sops\n  broken: [\n"), 0o600))
+
+		configPath := filepath.Join(t.TempDir(), ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("rules: []\n"), 0o600))
+
+		var sb strings.Builder
+		require.NoError(t, run(&sb, []string{"--config", configPath, tmpDir}))
+		assert.Contains(t, sb.String(), "Found unreadable file "+filepath.Join(tmpDir, "broken.yaml"))
+		assert.Contains(t, sb.String(), "[unreadableFile] (warning) Failed to read file:")
+		assert.NotContains(t, sb.String(), "malformed")
+		assert.Contains(t, sb.String(), "No errors found, but found warnings in 1 files")
+
+		err := run(&sb, []string{"--config", configPath, "--fail-on-malformed", tmpDir})
+		require.ErrorContains(t, err, "found 1 files with issues")
+	})
+
+	t.Run("unencrypted files", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "prod"), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "prod", "app.yaml"), []byte("password: hunter2\n"), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "secrets.json"), []byte(`{"password": "hunter2"}`), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "values.json"), []byte(`{"replicas": 3}`), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, ".sops.yaml"), []byte(`
+creation_rules:
+  - path_regex: ^prod/
+    age: age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun`), 0o600))
+
+		configPath := filepath.Join(t.TempDir(), ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("allowUnmatched: true\nrequireEncrypted: ['**/secrets*.json']\nrules: []\n"), 0o600))
+
+		var sb strings.Builder
+		err := run(&sb, []string{"--config", configPath, tmpDir})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "found 2 files with issues")
+		assert.Contains(t, sb.String(), "Found unencrypted file "+filepath.Join(tmpDir, "prod", "app.yaml"))
+		assert.Contains(t, sb.String(), `[requireEncrypted] Expected an encrypted SOPS file, because it matches creation_rules[0] (path_regex: "^prod/")`)
+		assert.Contains(t, sb.String(), "Found unencrypted file "+filepath.Join(tmpDir, "secrets.json"))
+		assert.NotContains(t, sb.String(), "values.json")
+	})
+
+	t.Run("changed files with unchanged .sops.yaml", func(t *testing.T) {
+		if _, err := exec.LookPath("git"); err != nil {
+			t.Skip("git is not installed")
+		}
+
+		repoDir := t.TempDir()
+
+		git := func(args ...string) {
+			cmd := exec.Command("git", append([]string{"-C", repoDir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+			output, err := cmd.CombinedOutput()
+			require.NoError(t, err, string(output))
+		}
+
+		require.NoError(t, os.WriteFile(filepath.Join(repoDir, ".sops.yaml"), []byte(`
+creation_rules:
+  - path_regex: ^prod/
+    age: age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun`), 0o600))
+
+		git("init", "-q")
+		git("add", ".")
+		git("commit", "-q", "-m", "initial")
+
+		require.NoError(t, os.MkdirAll(filepath.Join(repoDir, "prod"), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(repoDir, "prod", "app.yaml"), []byte("password: hunter2\n"), 0o600))
+
+		configPath := filepath.Join(t.TempDir(), ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("allowUnmatched: true\nrules: []\n"), 0o600))
+
+		var sb strings.Builder
+		err := run(&sb, []string{"--config", configPath, "--changed-since", "HEAD", repoDir})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "found 1 files with issues")
+		assert.Contains(t, sb.String(), "Found unencrypted file "+filepath.Join(repoDir, "prod", "app.yaml"))
+	})
+
+	t.Run("default ignores", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		data, err := os.ReadFile("internal/sops/testdata/valid_sops_files/encrypted.yaml")
+		require.NoError(t, err)
+
+		for _, name := range []string{"secret.yaml", "build/secret.yaml", "local/secret.yaml", "vendor/secret.yaml"} {
+			require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, name)), 0o700))
+			require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), data, 0o600))
+		}
+
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, ".gitignore"), []byte("build/\n"), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, ".sops-checkignore"), []byte("local/\n"), 0o600))
+
+		configPath := filepath.Join(t.TempDir(), ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("exclude: [vendor/]\nrules:\n  - matchType: kms\n"), 0o600))
+
+		var sb strings.Builder
+		err = run(&sb, []string{"--config", configPath, tmpDir})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "found 1 files with issues")
+		assert.Contains(t, sb.String(), "Found issues in "+filepath.Join(tmpDir, "secret.yaml"))
+
+		sb.Reset()
+		err = run(&sb, []string{"--config", configPath, "--no-default-ignores", tmpDir})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "found 3 files with issues")
+		assert.NotContains(t, sb.String(), filepath.Join(tmpDir, "vendor"))
+
+		sb.Reset()
+		err = run(&sb, []string{"--config", configPath, "--explain-ignore", filepath.Join(tmpDir, "build", "secret.yaml"), tmpDir})
+		require.NoError(t, err)
+		assert.Contains(t, sb.String(), "secret.yaml is ignored, because its parent directory ")
+		assert.Contains(t, sb.String(), ".gitignore:1: build/")
+	})
+
+	t.Run("multiple paths", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		sarifPath := filepath.Join(t.TempDir(), "combined.sarif")
+
+		data, err := os.ReadFile("internal/sops/testdata/valid_sops_files/encrypted.yaml")
+		require.NoError(t, err)
+
+		for _, name := range []string{"envs/secret.yaml", "charts/secret.yaml", "other/secret.yaml"} {
+			require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, name)), 0o700))
+			require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), data, 0o600))
+		}
+
+		configPath := filepath.Join(t.TempDir(), ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("rules:\n  - matchType: kms\n"), 0o600))
+
+		var sb strings.Builder
+		err = run(&sb, []string{"--config", configPath, "--sarif-report-path", sarifPath, filepath.Join(tmpDir, "envs"), filepath.Join(tmpDir, "charts")})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "found 2 files with issues")
+		assert.NotContains(t, sb.String(), "other")
+
+		createdSarif, err := os.ReadFile(sarifPath)
+		require.NoError(t, err)
+		assert.Contains(t, string(createdSarif), filepath.Join(tmpDir, "envs", "secret.yaml"))
+		assert.Contains(t, string(createdSarif), filepath.Join(tmpDir, "charts", "secret.yaml"))
+	})
+
+	t.Run("explicit files", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("rules:\n  - matchType: kms\n"), 0o600))
+
+		var sb strings.Builder
+		err := run(&sb, []string{
+			"--config", configPath,
+			"internal/sops/testdata/valid_sops_files/encrypted.yaml",
+			"internal/sops/testdata/valid_sops_files/encrypted.json",
+		})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "found 2 files with issues")
+		assert.NotContains(t, sb.String(), "encrypted.ini")
+	})
+
+	t.Run("stdin", func(t *testing.T) {
+		data, err := os.ReadFile("internal/sops/testdata/valid_sops_files/encrypted.json")
+		require.NoError(t, err)
+
+		t.Cleanup(func() { stdin = os.Stdin })
+
+		configPath := filepath.Join(t.TempDir(), ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte(`
+allowUnmatched: true
+requireEncrypted: [prod/]
+rules:
+  - matchType: kms
+    paths: [prod/]
+`), 0o600))
+
+		var sb strings.Builder
+		stdin = bytes.NewReader(data)
+		err = run(&sb, []string{"--config", configPath, "--stdin-filename", "prod/secret.json", "-"})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "found 1 files with issues")
+		assert.Contains(t, sb.String(), "Found issues in prod/secret.json:")
+
+		dotenv, err := os.ReadFile("internal/sops/testdata/valid_sops_files/encrypted.env")
+		require.NoError(t, err)
+
+		sb.Reset()
+		stdin = bytes.NewReader(dotenv)
+		err = run(&sb, []string{"--config", configPath, "--stdin-filename", "prod/secret.yaml", "--stdin-format", "dotenv", "-"})
+		require.Error(t, err)
+		assert.Contains(t, sb.String(), "Found issues in prod/secret.yaml:")
+		assert.NotContains(t, sb.String(), "malformed")
+
+		sb.Reset()
+		stdin = strings.NewReader("password: hunter2\n")
+		err = run(&sb, []string{"--config", configPath, "--stdin-filename", "prod/secret.yaml", "-"})
+		require.Error(t, err)
+		assert.Contains(t, sb.String(), "Found unencrypted file prod/secret.yaml")
+	})
+
+	t.Run("explicit files and stdin with .sops.yaml", func(t *testing.T) {
+		wd, err := os.Getwd()
+		require.NoError(t, err)
+
+		tmpDir := t.TempDir()
+		require.NoError(t, os.Chdir(tmpDir))
+		t.Cleanup(func() {
+			stdin = os.Stdin
+			require.NoError(t, os.Chdir(wd))
+		})
+
+		require.NoError(t, os.MkdirAll(filepath.Join("envs", "prod"), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join("envs", "prod", "app.yaml"), []byte("password: hunter2\n"), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join("envs", ".sops.yaml"), []byte(`
+creation_rules:
+  - path_regex: ^prod/
+    age: age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun`), 0o600))
+
+		configPath := filepath.Join(t.TempDir(), ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("allowUnmatched: true\nrules: []\n"), 0o600))
+
+		var sb strings.Builder
+		err = run(&sb, []string{"--config", configPath, filepath.Join("envs", "prod", "app.yaml")})
+		require.Error(t, err)
+		assert.Contains(t, sb.String(), `because it matches creation_rules[0] (path_regex: "^prod/") in envs/.sops.yaml`)
+
+		sb.Reset()
+		stdin = strings.NewReader("password: hunter2\n")
+		err = run(&sb, []string{"--config", configPath, "--stdin-filename", "envs/prod/other.yaml", "-"})
+		require.Error(t, err)
+		assert.Contains(t, sb.String(), `because it matches creation_rules[0] (path_regex: "^prod/") in envs/.sops.yaml`)
+	})
+
+	t.Run("JSON report", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("rules:\n  - match: this-is-trust-anchor-a\n    id: team-key\n"), 0o600))
+
+		reportPath := filepath.Join(tmpDir, "report.json")
+		sarifPath := filepath.Join(tmpDir, "report.sarif")
+		junitPath := filepath.Join(tmpDir, "junit.xml")
+
+		var sb strings.Builder
+		err := run(&sb, []string{"--config", configPath, "--output", "json", "--report", "json=" + reportPath, "--report", "sarif=" + sarifPath, "--report", "junit=" + junitPath, "internal/sops/testdata/valid_sops_files/encrypted.yaml"})
+		require.ErrorContains(t, err, "found 1 files with issues")
+		assert.NotContains(t, sb.String(), "Found issues in")
+
+		var output struct {
+			Files []struct {
+				Path   string
+				Status string
+				Result struct {
+					Success bool
+					Nested  []struct {
+						Rule struct {
+							Kind string
+							ID   string
+						}
+					}
+				}
+			}
+			Summary struct {
+				Files  int
+				Failed int
+			}
+		}
+		require.NoError(t, json.Unmarshal([]byte(sb.String()), &output))
+
+		require.Len(t, output.Files, 1)
+		assert.Equal(t, "internal/sops/testdata/valid_sops_files/encrypted.yaml", output.Files[0].Path)
+		assert.Equal(t, "fail", output.Files[0].Status)
+		assert.False(t, output.Files[0].Result.Success)
+		assert.Equal(t, "match", output.Files[0].Result.Nested[0].Rule.Kind)
+		assert.Equal(t, "team-key", output.Files[0].Result.Nested[0].Rule.ID)
+		assert.Equal(t, 1, output.Summary.Files)
+		assert.Equal(t, 1, output.Summary.Failed)
+
+		report, err := os.ReadFile(reportPath)
+		require.NoError(t, err)
+		assert.Equal(t, sb.String(), string(report))
+
+		sarifReport, err := os.ReadFile(sarifPath)
+		require.NoError(t, err)
+		assert.Contains(t, string(sarifReport), `"ruleId": "team-key"`)
+
+		junitReport, err := os.ReadFile(junitPath)
+		require.NoError(t, err)
+		assert.Contains(t, string(junitReport), `<testcase name="internal/sops/testdata/valid_sops_files/encrypted.yaml" classname="internal/sops/testdata/valid_sops_files">`)
+		assert.Contains(t, string(junitReport), `<failure message=`)
+	})
+
+	t.Run("CI output", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("rules:\n  - match: this-is-trust-anchor-a\n    id: team-key\n"), 0o600))
+
+		path := "internal/sops/testdata/valid_sops_files/encrypted.yaml"
+
+		t.Setenv("GITHUB_ACTIONS", "true")
+
+		var sb strings.Builder
+		err := run(&sb, []string{"--config", configPath, path})
+		require.ErrorContains(t, err, "found 1 files with issues")
+		assert.Contains(t, sb.String(), "Found issues in")
+		assert.Contains(t, sb.String(), "::error file="+path+",line=2,col=1,title=team-key::[match] Expected trust anchor")
+
+		var issues []struct {
+			CheckName string `json:"check_name"`
+			Severity  string
+			Location  struct {
+				Path string
+			}
+		}
+
+		sb.Reset()
+		err = run(&sb, []string{"--config", configPath, "--output", "gitlab-codequality", path})
+		require.ErrorContains(t, err, "found 1 files with issues")
+		require.NoError(t, json.Unmarshal([]byte(sb.String()), &issues))
+		require.NotEmpty(t, issues)
+		assert.Equal(t, "team-key", issues[0].CheckName)
+		assert.Equal(t, "major", issues[0].Severity)
+		assert.Equal(t, path, issues[0].Location.Path)
+	})
+
+	t.Run("GitLab CI output", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("rules:\n  - match: this-is-trust-anchor-a\n    id: team-key\n"), 0o600))
+
+		path, err := filepath.Abs("internal/sops/testdata/valid_sops_files/encrypted.yaml")
+		require.NoError(t, err)
+
+		wd, err := os.Getwd()
+		require.NoError(t, err)
+
+		require.NoError(t, os.Chdir(t.TempDir()))
+		t.Cleanup(func() {
+			require.NoError(t, os.Chdir(wd))
+		})
+
+		t.Setenv("GITLAB_CI", "true")
+
+		var sb strings.Builder
+		err = run(&sb, []string{"--config", configPath, path})
+		require.ErrorContains(t, err, "found 1 files with issues")
+		assert.Contains(t, sb.String(), "Found issues in")
+
+		var issues []struct {
+			CheckName string `json:"check_name"`
+		}
+
+		report, err := os.ReadFile("gl-code-quality-report.json")
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(report, &issues))
+		require.NotEmpty(t, issues)
+		assert.Equal(t, "team-key", issues[0].CheckName)
+	})
+
+	t.Run("deterministic output", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("rules:\n  - match: this-is-trust-anchor-a\n"), 0o600))
+
+		var serial, concurrent strings.Builder
+		serialErr := run(&serial, []string{"--config", configPath, "--ignore-file", ".tests-ignore", "--jobs", "1", "."})
+		concurrentErr := run(&concurrent, []string{"--config", configPath, "--ignore-file", ".tests-ignore", "--jobs", "8", "."})
+
+		require.Error(t, serialErr)
+		assert.Equal(t, serialErr, concurrentErr)
+		assert.Equal(t, serial.String(), concurrent.String())
+	})
+
+	t.Run("history", func(t *testing.T) {
+		if _, err := exec.LookPath("git"); err != nil {
+			t.Skip("git is not installed")
+		}
+
+		repoDir := t.TempDir()
+
+		git := func(args ...string) string {
+			cmd := exec.Command("git", append([]string{"-C", repoDir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+			output, err := cmd.CombinedOutput()
+			require.NoError(t, err, string(output))
+			return strings.TrimSpace(string(output))
+		}
+
+		oldVersion, err := os.ReadFile("internal/sops/testdata/valid_sops_files/encrypted.yaml")
+		require.NoError(t, err)
+		newVersion := []byte(strings.ReplaceAll(string(oldVersion),
+			"age1yt3tfqlfrwdwx0z0ynwplcr6qxcxfaqycuprpmy89nr83ltx74tqdpszlw",
+			"age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun"))
+
+		commit := func(data []byte) string {
+			require.NoError(t, os.WriteFile(filepath.Join(repoDir, "secret.yaml"), data, 0o600))
+			git("add", ".")
+			git("commit", "-q", "-m", "update secret")
+			return git("rev-parse", "HEAD")
+		}
+
+		git("init", "-q")
+		firstCommit := commit(oldVersion)
+		commit(newVersion)
+		commit(oldVersion)
+		commit(newVersion)
+
+		configPath := filepath.Join(t.TempDir(), ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("rules:\n  - match: age1lzd99uklcjnc0e7d860axevet2cz99ce9pq6tzuzd05l5nr28ams36nvun\n"), 0o600))
+
+		var sb strings.Builder
+		err = run(&sb, []string{"--config", configPath, repoDir})
+		require.NoError(t, err)
+
+		sb.Reset()
+		err = run(&sb, []string{"--config", configPath, "history", repoDir})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "found 1 file versions with issues in the history")
+		assert.Contains(t, sb.String(), fmt.Sprintf("Found issues in secret.yaml (commit %s):", firstCommit))
+		assert.Equal(t, 1, strings.Count(sb.String(), "Found issues in"))
+
+		sb.Reset()
+		err = run(&sb, []string{"--config", configPath, "history", "--range", firstCommit + "..HEAD~2", repoDir})
+		require.NoError(t, err)
+		assert.NotContains(t, sb.String(), "Found issues in")
+	})
+
+	t.Run("history of subdirectories", func(t *testing.T) {
+		if _, err := exec.LookPath("git"); err != nil {
+			t.Skip("git is not installed")
+		}
+
+		repoDir := t.TempDir()
+
+		git := func(args ...string) {
+			cmd := exec.Command("git", append([]string{"-C", repoDir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+			output, err := cmd.CombinedOutput()
+			require.NoError(t, err, string(output))
+		}
+
+		data, err := os.ReadFile("internal/sops/testdata/valid_sops_files/encrypted.yaml")
+		require.NoError(t, err)
+
+		for name, content := range map[string][]byte{
+			"envs/prod/secret.yaml": data,
+			"envs/old/secret.yaml":  data,
+			"envs/dev/broken.yaml":  []byte("data: value\nsops:\n  age: [\n"),
+			"charts/secret.yaml":    data,
+			"other/secret.yaml":     data,
+		} {
+			require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(repoDir, name)), 0o700))
+			require.NoError(t, os.WriteFile(filepath.Join(repoDir, name), content, 0o600))
+		}
+
+		git("init", "-q")
+		git("add", ".")
+		git("commit", "-q", "-m", "initial")
+
+		// Every file contains the same blob, but only the copy in charts/
+		// violates its path-scoped rule. Ignore patterns are relative to
+		// the check path.
+		configPath := filepath.Join(t.TempDir(), ".sops-check.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte(`
+allowUnmatched: true
+exclude: [old/]
+rules:
+  - matchType: kms
+    paths: [envs/old/**, charts/**]
+`), 0o600))
+
+		var sb strings.Builder
+		err = run(&sb, []string{"--config", configPath, "history", filepath.Join(repoDir, "envs"), filepath.Join(repoDir, "charts")})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "found 1 file versions with issues in the history")
+		assert.Contains(t, sb.String(), "Found issues in charts/secret.yaml (commit ")
+		assert.Contains(t, sb.String(), "Found malformed SOPS file envs/dev/broken.yaml (commit ")
+		assert.NotContains(t, sb.String(), "old/secret.yaml")
+		assert.NotContains(t, sb.String(), "other")
+
+		sb.Reset()
+		err = run(&sb, []string{"--config", configPath, "--fail-on-malformed", "history", filepath.Join(repoDir, "envs")})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "envs/dev/broken.yaml")
+	})
+
 	t.Run("bad config file", func(t *testing.T) {
 		cfg := &config.Config{
 			AllowUnmatched: false,